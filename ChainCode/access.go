@@ -0,0 +1,271 @@
+package main
+
+import (
+        "fmt"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Role is the supply-chain role of the identity submitting a transaction.
+type Role string
+
+// Roles recognised by the chaincode.
+const (
+        RoleManufacturer Role = "manufacturer"
+        RoleDistributor  Role = "distributor"
+        RolePharmacy     Role = "pharmacy"
+        RoleRegulator    Role = "regulator"
+        RoleAdmin        Role = "admin"
+)
+
+// Action is an operation guarded by the permission matrix.
+type Action string
+
+// Actions checked by the SmartContract transactions.
+const (
+        ActionRead         Action = "read"
+        ActionInitLedger   Action = "initialise the ledger"
+        ActionCreate       Action = "create medicines"
+        ActionUpdate       Action = "update medicines"
+        ActionRelease      Action = "release medicines"
+        ActionDelete       Action = "hard delete medicines"
+        ActionTransfer     Action = "transfer medicines"
+        ActionRecall       Action = "recall batches"
+        ActionTrade        Action = "manage commercial terms"
+        ActionVerify       Action = "verify medicines"
+        ActionDecommission Action = "decommission medicines"
+        ActionRegister     Action = "maintain the product and participant registries"
+        ActionCatalog      Action = "maintain the product catalog"
+        ActionPack         Action = "pack and unpack containers"
+        ActionDispense     Action = "dispense medicines to patients"
+        ActionReturn       Action = "return medicines to their manufacturer"
+)
+
+// roleAttribute is the X.509 certificate attribute holding the caller's role.
+// Register identities with e.g. --id.attrs 'role=pharmacy:ecert'.
+const roleAttribute = "role"
+
+// participantAttribute is the X.509 certificate attribute binding an identity
+// to the SenderId/ReceiverId it acts as in custody handovers.
+const participantAttribute = "participantId"
+
+// permissions is the permission matrix for each role.
+var permissions = map[Role]map[Action]bool{
+        RoleManufacturer: {
+                ActionRead:         true,
+                ActionInitLedger:   true,
+                ActionCreate:       true,
+                ActionUpdate:       true,
+                ActionRelease:      true,
+                ActionTransfer:     true,
+                ActionTrade:        true,
+                ActionVerify:       true,
+                ActionDecommission: true,
+                ActionCatalog:      true,
+                ActionPack:         true,
+                ActionReturn:       true,
+        },
+        RoleDistributor: {
+                ActionRead:         true,
+                ActionTransfer:     true,
+                ActionTrade:        true,
+                ActionVerify:       true,
+                ActionDecommission: true,
+                ActionPack:         true,
+                ActionReturn:       true,
+        },
+        RolePharmacy: {
+                ActionRead:         true,
+                ActionTransfer:     true,
+                ActionTrade:        true,
+                ActionVerify:       true,
+                ActionDecommission: true,
+                ActionPack:         true,
+                ActionDispense:     true,
+                ActionReturn:       true,
+        },
+        RoleRegulator: {
+                ActionRead:         true,
+                ActionInitLedger:   true,
+                ActionRecall:       true,
+                ActionVerify:       true,
+                ActionDecommission: true,
+                ActionRegister:     true,
+        },
+        RoleAdmin: {
+                ActionRead:   true,
+                ActionDelete: true,
+        },
+}
+
+// roleMSPs restricts which organisations may hold a role, so that a member
+// CA cannot issue itself regulator certificates. Roles without an entry may
+// be held by any organisation on the channel.
+var roleMSPs = map[Role][]string{
+        RoleRegulator: {"Org2MSP"},
+        RoleAdmin:     {"Org2MSP"},
+}
+
+// mspDefaultRoles is used for identities enrolled without a role attribute,
+// such as the test network's pre-generated users.
+var mspDefaultRoles = map[string]Role{
+        "Org1MSP": RoleManufacturer,
+        "Org2MSP": RoleRegulator,
+        "Org3MSP": RoleDistributor,
+        "Org4MSP": RolePharmacy,
+}
+
+// AuthorizationError is returned when the caller's identity does not permit a
+// transaction. Reason, when set, explains a denial that is not down to the role.
+type AuthorizationError struct {
+        MSPID  string
+        Role   Role
+        Action Action
+        Reason string
+}
+
+func (e *AuthorizationError) Error() string {
+        if e.Reason != "" {
+                return fmt.Sprintf("authorization denied: %s", e.Reason)
+        }
+        if e.Role == "" {
+                return fmt.Sprintf("authorization denied: identity from %s has no role and may not %s", e.MSPID, e.Action)
+        }
+
+        return fmt.Sprintf("authorization denied: %s identity from %s may not %s", e.Role, e.MSPID, e.Action)
+}
+
+// getCallerRole returns the MSP ID and role of the identity submitting the
+// transaction. The role is empty when none can be determined.
+func getCallerRole(ctx contractapi.TransactionContextInterface) (string, Role, error) {
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return "", "", fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+
+        value, found, err := ctx.GetClientIdentity().GetAttributeValue(roleAttribute)
+        if err != nil {
+                return "", "", fmt.Errorf("failed to get client role attribute: %v", err)
+        }
+        if !found {
+                return mspID, mspDefaultRoles[mspID], nil
+        }
+
+        role := Role(value)
+        if _, ok := permissions[role]; !ok {
+                return mspID, "", nil
+        }
+
+        if allowed, ok := roleMSPs[role]; ok {
+                for _, allowedMSPID := range allowed {
+                        if allowedMSPID == mspID {
+                                return mspID, role, nil
+                        }
+                }
+                return mspID, "", nil
+        }
+
+        return mspID, role, nil
+}
+
+// authorize returns an AuthorizationError unless the caller's role permits the action.
+func authorize(ctx contractapi.TransactionContextInterface, action Action) error {
+        mspID, role, err := getCallerRole(ctx)
+        if err != nil {
+                return err
+        }
+
+        if !permissions[role][action] {
+                return &AuthorizationError{MSPID: mspID, Role: role, Action: action}
+        }
+
+        return nil
+}
+
+// getCallerParticipantID returns the participant ID the caller's certificate is bound to.
+func getCallerParticipantID(ctx contractapi.TransactionContextInterface) (string, error) {
+        value, found, err := ctx.GetClientIdentity().GetAttributeValue(participantAttribute)
+        if err != nil {
+                return "", fmt.Errorf("failed to get client participant attribute: %v", err)
+        }
+        if !found || value == "" {
+                mspID, _ := ctx.GetClientIdentity().GetMSPID()
+                return "", &AuthorizationError{
+                        MSPID:  mspID,
+                        Reason: fmt.Sprintf("identity from %s is not bound to a participant, the %s attribute is missing", mspID, participantAttribute),
+                }
+        }
+
+        return value, nil
+}
+
+// getCallerSubject returns the subject of the caller's X.509 certificate.
+func getCallerSubject(ctx contractapi.TransactionContextInterface) (string, error) {
+        cert, err := ctx.GetClientIdentity().GetX509Certificate()
+        if err != nil {
+                return "", fmt.Errorf("failed to get client certificate: %v", err)
+        }
+        if cert == nil {
+                return "", fmt.Errorf("the client identity has no X.509 certificate")
+        }
+
+        return cert.Subject.String(), nil
+}
+
+// authorizeParticipant returns an AuthorizationError unless the caller acts as the given
+// participant and, once the participant is registered, belongs to its MSP.
+func authorizeParticipant(ctx contractapi.TransactionContextInterface, participantID string) error {
+        callerID, err := getCallerParticipantID(ctx)
+        if err != nil {
+                return err
+        }
+
+        mspID, _ := ctx.GetClientIdentity().GetMSPID()
+        if callerID != participantID {
+                return &AuthorizationError{
+                        MSPID:  mspID,
+                        Reason: fmt.Sprintf("caller acts as %s, not %s", callerID, participantID),
+                }
+        }
+
+        participant, err := getParticipant(ctx, participantID)
+        if err != nil {
+                return err
+        }
+        if participant != nil && participant.MSPID != mspID {
+                return &AuthorizationError{
+                        MSPID:  mspID,
+                        Reason: fmt.Sprintf("participant %s is bound to %s, not %s", participantID, participant.MSPID, mspID),
+                }
+        }
+
+        return nil
+}
+
+// authorizeManufacturer returns an AuthorizationError unless the caller acts as
+// a registered manufacturer participant whose name is manufacturer, the name
+// recorded on products and units.
+func authorizeManufacturer(ctx contractapi.TransactionContextInterface, manufacturer string) error {
+        callerID, err := getCallerParticipantID(ctx)
+        if err != nil {
+                return err
+        }
+        err = authorizeParticipant(ctx, callerID)
+        if err != nil {
+                return err
+        }
+
+        participant, err := getParticipant(ctx, callerID)
+        if err != nil {
+                return err
+        }
+        if participant == nil || participant.Type != ParticipantManufacturer || !sameText(participant.Name, manufacturer) {
+                mspID, _ := ctx.GetClientIdentity().GetMSPID()
+                return &AuthorizationError{
+                        MSPID:  mspID,
+                        Reason: fmt.Sprintf("caller acts as %s, not as the manufacturer %s", callerID, manufacturer),
+                }
+        }
+
+        return nil
+}
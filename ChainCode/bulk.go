@@ -0,0 +1,156 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// BulkItemError is the reason a single item of a bulk transaction was rejected.
+type BulkItemError struct {
+        Index int    `json:"Index"`
+        ID    string `json:"ID"`
+        Error string `json:"Error"`
+}
+
+// bulkErrorPrefix separates the summary of a BulkError message from the
+// BulkError as JSON. Clients decode the JSON value that follows it.
+const bulkErrorPrefix = "rejected items: "
+
+// BulkError is returned when a bulk transaction rejects one or more items.
+// Bulk transactions are all or nothing, so none of the items were written.
+// The error message is a summary followed by bulkErrorPrefix and the BulkError
+// as JSON, so that clients can report every rejected item.
+type BulkError struct {
+        Action Action          `json:"Action"`
+        Total  int             `json:"Total"`
+        Items  []BulkItemError `json:"Items"`
+}
+
+func (e *BulkError) Error() string {
+        summary := fmt.Sprintf("failed to %s: %d of %d items rejected, nothing was committed", e.Action, len(e.Items), e.Total)
+
+        payload, err := json.Marshal(e)
+        if err != nil {
+                return summary
+        }
+
+        return summary + "; " + bulkErrorPrefix + string(payload)
+}
+
+// add records the rejection of an item.
+func (e *BulkError) add(index int, id string, err error) {
+        e.Items = append(e.Items, BulkItemError{Index: index, ID: id, Error: err.Error()})
+}
+
+// CreateMedicines issues every medicine in the list in a single transaction.
+// Each item is validated as by CreateMedicineJSON; if any is rejected, the
+// transaction fails with a BulkError listing every rejected item and no
+// medicine is created.
+func (s *SmartContract) CreateMedicines(ctx contractapi.TransactionContextInterface, medicines []MedicineInput) ([]*Medicine, error) {
+        err := authorize(ctx, ActionCreate)
+        if err != nil {
+                return nil, err
+        }
+        if len(medicines) == 0 {
+                return nil, fmt.Errorf("no medicines to create")
+        }
+
+        bulkErr := &BulkError{Action: ActionCreate, Total: len(medicines)}
+        seen := make(map[string]bool, len(medicines))
+        created := make([]*Medicine, 0, len(medicines))
+        ids := make([]string, 0, len(medicines))
+        for i := range medicines {
+                input := &medicines[i]
+                if seen[input.ID] {
+                        bulkErr.add(i, input.ID, fmt.Errorf("the medicine %s appears more than once", input.ID))
+                        continue
+                }
+                seen[input.ID] = true
+
+                medicine, err := s.createMedicine(ctx, input)
+                if err != nil {
+                        bulkErr.add(i, input.ID, err)
+                        continue
+                }
+                created = append(created, medicine)
+                ids = append(ids, medicine.ID)
+        }
+        if len(bulkErr.Items) > 0 {
+                return nil, bulkErr
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicinesCreated, Units: ids})
+        if err != nil {
+                return nil, err
+        }
+
+        return created, nil
+}
+
+// TransferMedicines starts a custody handover of every listed medicine from
+// senderId to receiverId in a single transaction, as by TransferMedicine. If
+// any medicine cannot be transferred, the transaction fails with a BulkError
+// listing every rejected item and no transfer is started.
+func (s *SmartContract) TransferMedicines(ctx contractapi.TransactionContextInterface,
+        ids []string, senderId string, receiverId string) ([]*Transfer, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+        if len(ids) == 0 {
+                return nil, fmt.Errorf("no medicines to transfer")
+        }
+
+        err = authorizeParticipant(ctx, senderId)
+        if err != nil {
+                return nil, err
+        }
+        err = checkTransferParties(ctx, senderId, receiverId)
+        if err != nil {
+                return nil, err
+        }
+
+        bulkErr := &BulkError{Action: ActionTransfer, Total: len(ids)}
+        seen := make(map[string]bool, len(ids))
+        transfers := make([]*Transfer, 0, len(ids))
+        for i, id := range ids {
+                if seen[id] {
+                        bulkErr.add(i, id, fmt.Errorf("the medicine %s appears more than once", id))
+                        continue
+                }
+                seen[id] = true
+
+                medicine, err := s.ReadMedicine(ctx, id)
+                if err != nil {
+                        bulkErr.add(i, id, err)
+                        continue
+                }
+                if medicine.ReceiverID != senderId {
+                        bulkErr.add(i, id, fmt.Errorf("the medicine %s is held by %s, not %s", id, medicine.ReceiverID, senderId))
+                        continue
+                }
+                if medicine.ContainerID != "" {
+                        bulkErr.add(i, id, fmt.Errorf("the medicine %s is packed in container %s", id, medicine.ContainerID))
+                        continue
+                }
+
+                transfer, err := startTransfer(ctx, medicine, receiverId, "")
+                if err != nil {
+                        bulkErr.add(i, id, err)
+                        continue
+                }
+                transfers = append(transfers, transfer)
+        }
+        if len(bulkErr.Items) > 0 {
+                return nil, bulkErr
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicinesTransferInitiated, Units: ids})
+        if err != nil {
+                return nil, err
+        }
+
+        return transfers, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+        "encoding/json"
+        "strings"
+        "testing"
+)
+
+func TestBulkErrorListsRejectedItems(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        unregistered := medicineInput("M2")
+        unregistered.DRAPNo = "DRAP-8"
+        _, err := ledger.contract.CreateMedicines(ledger.manufacturer(), []MedicineInput{
+                medicineInput("M1"), unregistered, medicineInput("M1"),
+        })
+        if err == nil {
+                t.Fatalf("expected the bulk creation to fail")
+        }
+
+        message := err.Error()
+        start := strings.Index(message, bulkErrorPrefix)
+        if start < 0 {
+                t.Fatalf("expected the error to carry %q, got %q", bulkErrorPrefix, message)
+        }
+        var bulkErr BulkError
+        decodeErr := json.Unmarshal([]byte(message[start+len(bulkErrorPrefix):]), &bulkErr)
+        if decodeErr != nil {
+                t.Fatalf("expected a JSON BulkError after %q, got %q: %v", bulkErrorPrefix, message, decodeErr)
+        }
+        if bulkErr.Action != ActionCreate || bulkErr.Total != 3 || len(bulkErr.Items) != 2 {
+                t.Fatalf("unexpected bulk error %+v", bulkErr)
+        }
+        if bulkErr.Items[0].Index != 1 || bulkErr.Items[0].ID != "M2" || bulkErr.Items[1].Index != 2 {
+                t.Fatalf("unexpected rejected items %+v", bulkErr.Items)
+        }
+}
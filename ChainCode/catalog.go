@@ -0,0 +1,320 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// productObjectType keys catalog products by GTIN.
+const productObjectType = "product"
+
+// Product is a catalog entry holding the static attributes shared by every
+// unit of a SKU. Units that reference a product by GTIN do not store Name,
+// BrandName, Composition or DosageForm themselves; ReadMedicine fills them in
+// from the catalog, so a correction here applies to every unit at once.
+// Manufacturer and DrapNo are fixed when the product is added and are still
+// copied onto units, since they identify the unit and are indexed.
+type Product struct {
+        GTIN         string    `json:"GTIN"`
+        Name         string    `json:"Name"`
+        BrandName    string    `json:"BrandName"`
+        Composition  string    `json:"Composition"`
+        DosageForm   string    `json:"DosageForm"`
+        Manufacturer string    `json:"Manufacturer"`
+        DRAPNo       string    `json:"DrapNo"`
+        UpdatedAt    time.Time `json:"UpdatedAt"`
+        UpdatedBy    string    `json:"UpdatedBy"`
+        TxID         string    `json:"TxId"`
+}
+
+// AddProduct adds a SKU to the product catalog. The product must match a valid
+// DRAP registration, and only its manufacturer can add it.
+func (s *SmartContract) AddProduct(ctx contractapi.TransactionContextInterface, gtin string, name string,
+        brandName string, composition string, dosageForm string, manufacturer string, drapNo string) (*Product, error) {
+        err := authorize(ctx, ActionCatalog)
+        if err != nil {
+                return nil, err
+        }
+
+        err = checkGTIN(gtin)
+        if err != nil {
+                return nil, err
+        }
+        existing, err := getProduct(ctx, gtin)
+        if err != nil {
+                return nil, err
+        }
+        if existing != nil {
+                return nil, fmt.Errorf("the product %s already exists", gtin)
+        }
+        if manufacturer == "" {
+                return nil, fmt.Errorf("a manufacturer is required to add product %s", gtin)
+        }
+        err = authorizeManufacturer(ctx, manufacturer)
+        if err != nil {
+                return nil, err
+        }
+
+        product := &Product{
+                GTIN:         gtin,
+                Name:         name,
+                BrandName:    brandName,
+                Composition:  composition,
+                DosageForm:   dosageForm,
+                Manufacturer: manufacturer,
+                DRAPNo:       drapNo,
+        }
+        err = checkRegistration(ctx, product.asMedicine())
+        if err != nil {
+                return nil, err
+        }
+
+        err = putProduct(ctx, product)
+        if err != nil {
+                return nil, err
+        }
+
+        return product, nil
+}
+
+// CorrectProduct changes the descriptive attributes of a product. Every unit
+// referencing the product reflects the correction without being rewritten.
+// Only the product's manufacturer can correct it, and the corrected product
+// must still match its DRAP registration.
+func (s *SmartContract) CorrectProduct(ctx contractapi.TransactionContextInterface, gtin string, name string,
+        brandName string, composition string, dosageForm string) (*Product, error) {
+        err := authorize(ctx, ActionCatalog)
+        if err != nil {
+                return nil, err
+        }
+
+        product, err := s.ReadProduct(ctx, gtin)
+        if err != nil {
+                return nil, err
+        }
+        err = authorizeManufacturer(ctx, product.Manufacturer)
+        if err != nil {
+                return nil, err
+        }
+
+        product.Name = name
+        product.BrandName = brandName
+        product.Composition = composition
+        product.DosageForm = dosageForm
+        err = checkRegistration(ctx, product.asMedicine())
+        if err != nil {
+                return nil, err
+        }
+
+        err = putProduct(ctx, product)
+        if err != nil {
+                return nil, err
+        }
+
+        return product, nil
+}
+
+// ReadProduct returns a product from the catalog.
+func (s *SmartContract) ReadProduct(ctx contractapi.TransactionContextInterface, gtin string) (*Product, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        product, err := getProduct(ctx, gtin)
+        if err != nil {
+                return nil, err
+        }
+        if product == nil {
+                return nil, fmt.Errorf("the product %s is not in the catalog", gtin)
+        }
+
+        return product, nil
+}
+
+// GetProducts returns every product in the catalog.
+func (s *SmartContract) GetProducts(ctx contractapi.TransactionContextInterface) ([]*Product, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(productObjectType, []string{})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get products from world state: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var products []*Product
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over products: %v", err)
+                }
+
+                var product Product
+                err = json.Unmarshal(queryResponse.Value, &product)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal product JSON: %v", err)
+                }
+                products = append(products, &product)
+        }
+
+        return products, nil
+}
+
+// asMedicine returns the product attributes as a Medicine for the checks
+// shared with units.
+func (p *Product) asMedicine() *Medicine {
+        return &Medicine{
+                Name:         p.Name,
+                BrandName:    p.BrandName,
+                Composition:  p.Composition,
+                DosageForm:   p.DosageForm,
+                Manufacturer: p.Manufacturer,
+                DRAPNo:       p.DRAPNo,
+        }
+}
+
+// applyProduct fills in the catalog attributes of a unit that references a
+// product. Attributes supplied on the unit must agree with the catalog.
+func applyProduct(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        if medicine.GTIN == "" {
+                return nil
+        }
+
+        product, err := getProduct(ctx, medicine.GTIN)
+        if err != nil {
+                return err
+        }
+        if product == nil {
+                return fmt.Errorf("the product %s of medicine %s is not in the catalog", medicine.GTIN, medicine.ID)
+        }
+
+        fields := []struct {
+                name    string
+                value   *string
+                catalog string
+        }{
+                {"Name", &medicine.Name, product.Name},
+                {"BrandName", &medicine.BrandName, product.BrandName},
+                {"Composition", &medicine.Composition, product.Composition},
+                {"DosageForm", &medicine.DosageForm, product.DosageForm},
+                {"Manufacturer", &medicine.Manufacturer, product.Manufacturer},
+                {"DrapNo", &medicine.DRAPNo, product.DRAPNo},
+        }
+        for _, field := range fields {
+                if *field.value != "" && *field.value != field.catalog {
+                        return fmt.Errorf("the %s %q of medicine %s does not match %q in product %s",
+                                field.name, *field.value, medicine.ID, field.catalog, product.GTIN)
+                }
+                *field.value = field.catalog
+        }
+
+        return nil
+}
+
+// stripProduct returns the record to store for a medicine, without the
+// attributes it takes from the catalog.
+func stripProduct(medicine *Medicine) *Medicine {
+        if medicine.GTIN == "" {
+                return medicine
+        }
+
+        stored := *medicine
+        stored.Name = ""
+        stored.BrandName = ""
+        stored.Composition = ""
+        stored.DosageForm = ""
+        return &stored
+}
+
+// checkGTIN returns an error unless gtin is a GTIN-8, -12, -13 or -14 with a
+// valid check digit.
+func checkGTIN(gtin string) error {
+        switch len(gtin) {
+        case 8, 12, 13, 14:
+        default:
+                return fmt.Errorf("invalid GTIN %q, expected 8, 12, 13 or 14 digits", gtin)
+        }
+
+        sum := 0
+        for i := len(gtin) - 1; i >= 0; i-- {
+                digit := int(gtin[i] - '0')
+                if digit < 0 || digit > 9 {
+                        return fmt.Errorf("invalid GTIN %q, expected only digits", gtin)
+                }
+                if i == len(gtin)-1 {
+                        continue
+                }
+                if (len(gtin)-1-i)%2 == 1 {
+                        digit *= 3
+                }
+                sum += digit
+        }
+
+        if (10-sum%10)%10 != int(gtin[len(gtin)-1]-'0') {
+                return fmt.Errorf("invalid GTIN %q, the check digit is wrong", gtin)
+        }
+
+        return nil
+}
+
+// getProduct returns a product, or nil if it is not in the catalog.
+func getProduct(ctx contractapi.TransactionContextInterface, gtin string) (*Product, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(productObjectType, []string{gtin})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create product key: %v", err)
+        }
+
+        productJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read product from world state: %v", err)
+        }
+        if productJSON == nil {
+                return nil, nil
+        }
+
+        var product Product
+        err = json.Unmarshal(productJSON, &product)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal product JSON: %v", err)
+        }
+
+        return &product, nil
+}
+
+// putProduct records who changed a product and when, and writes it.
+func putProduct(ctx contractapi.TransactionContextInterface, product *Product) error {
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+        product.UpdatedAt = now
+        product.UpdatedBy = mspID
+        product.TxID = ctx.GetStub().GetTxID()
+
+        key, err := ctx.GetStub().CreateCompositeKey(productObjectType, []string{product.GTIN})
+        if err != nil {
+                return fmt.Errorf("failed to create product key: %v", err)
+        }
+
+        productJSON, err := json.Marshal(product)
+        if err != nil {
+                return fmt.Errorf("failed to marshal product JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, productJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put product in world state: %v", err)
+        }
+
+        return nil
+}
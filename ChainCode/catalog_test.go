@@ -0,0 +1,39 @@
+package main
+
+import (
+        "testing"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestCatalogBelongsToManufacturer(t *testing.T) {
+        ledger := newTestLedger(t)
+        otherManufacturer := func() contractapi.TransactionContextInterface {
+                return ledger.as("Org1MSP", RoleManufacturer, "MFG2")
+        }
+
+        _, err := ledger.contract.AddProduct(otherManufacturer(), "8960000000016",
+                "Panadol", "Panadol", "Paracetamol", "Tablet", "GSK", "DRAP-7")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected adding a product in another manufacturer's name to be refused, got %v", err)
+        }
+        _, err = ledger.contract.AddProduct(ledger.manufacturer(), "8960000000016",
+                "Panadol", "Panadol", "Paracetamol", "Tablet", "GSK", "DRAP-7")
+        if err != nil {
+                t.Fatalf("failed to add product: %v", err)
+        }
+
+        _, err = ledger.contract.CorrectProduct(otherManufacturer(), "8960000000016",
+                "Panadol", "Panadol Forged", "Paracetamol", "Tablet")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected correcting another manufacturer's product to be refused, got %v", err)
+        }
+        product, err := ledger.contract.CorrectProduct(ledger.manufacturer(), "8960000000016",
+                "Panadol", "Panadol Advance", "Paracetamol", "Tablet")
+        if err != nil {
+                t.Fatalf("failed to correct product: %v", err)
+        }
+        if product.BrandName != "Panadol Advance" {
+                t.Fatalf("expected the brand name to be corrected, got %s", product.BrandName)
+        }
+}
@@ -4,6 +4,7 @@ import (
         "encoding/json"
         "fmt"
         "log"
+        "time"
 
         "github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -13,121 +14,313 @@ type SmartContract struct {
         contractapi.Contract
 }
 
-// Medicine describes the details of a medicine
+// Medicine describes the details of a medicine. TimeStamp records when the
+// medicine was last created, updated or moved, and is always taken from the
+// transaction header so that every endorser computes the same record.
 type Medicine struct {
+        SchemaVersion      int                `json:"SchemaVersion"`
+        ID                 string             `json:"ID"`
+        Name               string             `json:"Name"`
+        Manufacturer       string             `json:"Manufacturer"`
+        ManufactureDate    time.Time          `json:"ManufactureDate"`
+        ExpiryDate         time.Time          `json:"ExpiryDate"`
+        BrandName          string             `json:"BrandName"`
+        Composition        string             `json:"Composition"`
+        SenderID           string             `json:"SenderId"`
+        ReceiverID         string             `json:"ReceiverId"`
+        DRAPNo             string             `json:"DrapNo"`
+        DosageForm         string             `json:"DosageForm"`
+        TimeStamp          time.Time          `json:"TimeStamp"`
+        Batch_No           string             `json:"Batch_No"`
+        State              LifecycleState     `json:"State"`
+        JourneyCompleted   bool               `json:"JourneyCompleted"`
+        DecommissionReason DecommissionReason `json:"DecommissionReason,omitempty" metadata:",optional"`
+        DecommissionNote   string             `json:"DecommissionNote,omitempty" metadata:",optional"`
+        GTIN               string             `json:"GTIN,omitempty" metadata:",optional"`
+        ContainerID        string             `json:"ContainerId,omitempty" metadata:",optional"`
+        SubmitterMSPID     string             `json:"SubmitterMspId,omitempty" metadata:",optional"`
+        Submitter          string             `json:"Submitter,omitempty" metadata:",optional"`
+        ReturnReason       ReturnReason       `json:"ReturnReason,omitempty" metadata:",optional"`
+}
+
+// MedicineInput is the JSON document accepted by CreateMedicineJSON and
+// UpdateMedicineJSON, and built from the positional arguments of CreateMedicine
+// and UpdateMedicine. Dates are YYYY-MM-DD. TimeStamp is ignored since it is
+// taken from the transaction header, and JourneyCompleted since it is derived
+// from the lifecycle state. Units with a GTIN may leave out the attributes
+// they take from the product catalog.
+type MedicineInput struct {
         ID               string `json:"ID"`
-        Name             string `json:"Name"`
-        Manufacturer     string `json:"Manufacturer"`
+        Name             string `json:"Name" metadata:",optional"`
+        Manufacturer     string `json:"Manufacturer" metadata:",optional"`
         ManufactureDate  string `json:"ManufactureDate"`
         ExpiryDate       string `json:"ExpiryDate"`
-        BrandName        string `json:"BrandName"`
-        Composition      string `json:"Composition"`
+        BrandName        string `json:"BrandName" metadata:",optional"`
+        Composition      string `json:"Composition" metadata:",optional"`
         SenderID         string `json:"SenderId"`
         ReceiverID       string `json:"ReceiverId"`
-        DRAPNo           string `json:"DrapNo"`
-        DosageForm       string `json:"DosageForm"`
-        TimeStamp      string `json:"TimeStamp"`
+        DRAPNo           string `json:"DrapNo" metadata:",optional"`
+        DosageForm       string `json:"DosageForm" metadata:",optional"`
+        TimeStamp        string `json:"TimeStamp,omitempty" metadata:",optional"`
         Batch_No         string `json:"Batch_No"`
-        JourneyCompleted string `json:"JourneyCompleted"`
+        JourneyCompleted string `json:"JourneyCompleted,omitempty" metadata:",optional"`
+        GTIN             string `json:"GTIN,omitempty" metadata:",optional"`
 }
 
-// InitLedger adds a base set of medicines to the ledger
-func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-        medicines := []Medicine{
+// newMedicine validates a MedicineInput and builds a Medicine in the current
+// schema version. The lifecycle state is left for the caller to set.
+func newMedicine(ctx contractapi.TransactionContextInterface, input *MedicineInput) (*Medicine, error) {
+        if input.ID == "" {
+                return nil, fmt.Errorf("medicine ID must not be empty")
+        }
+
+        manufactured, err := parseDate(input.ManufactureDate)
+        if err != nil {
+                return nil, fmt.Errorf("invalid ManufactureDate: %v", err)
+        }
+        expires, err := parseDate(input.ExpiryDate)
+        if err != nil {
+                return nil, fmt.Errorf("invalid ExpiryDate: %v", err)
+        }
+        if !expires.After(manufactured) {
+                return nil, fmt.Errorf("ExpiryDate %s must be after ManufactureDate %s",
+                        expires.Format(dateLayout), manufactured.Format(dateLayout))
+        }
+
+        stamp, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        return &Medicine{
+                SchemaVersion:   medicineSchemaVersion,
+                ID:              input.ID,
+                Name:            input.Name,
+                Manufacturer:    input.Manufacturer,
+                ManufactureDate: manufactured,
+                ExpiryDate:      expires,
+                BrandName:       input.BrandName,
+                Composition:     input.Composition,
+                SenderID:        input.SenderID,
+                ReceiverID:      input.ReceiverID,
+                DRAPNo:          input.DRAPNo,
+                DosageForm:      input.DosageForm,
+                TimeStamp:       stamp,
+                Batch_No:        input.Batch_No,
+                GTIN:            input.GTIN,
+        }, nil
+}
+
+// putMedicine writes a medicine to the world state under its ID, leaving out
+// the attributes it takes from the product catalog. Every version records the
+// MSP and certificate subject of the client that submitted it, so the history
+// shows who made each change.
+func putMedicine(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+        subject, err := getCallerSubject(ctx)
+        if err != nil {
+                return err
+        }
+        medicine.SubmitterMSPID = mspID
+        medicine.Submitter = subject
+
+        medicineJSON, err := json.Marshal(stripProduct(medicine))
+        if err != nil {
+                return fmt.Errorf("failed to marshal medicine JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(medicine.ID, medicineJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put medicine in world state: %v", err)
+        }
+
+        return nil
+}
+
+// txTimestamp returns the transaction timestamp from the proposal header in
+// UTC, which is identical on every endorsing peer.
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+        ts, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+
+        return time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), nil
+}
+
+// sampleMedicines returns the sample medicines issued by InitLedger, stamped
+// with the given time. InitRegistry registers their products and parties.
+func sampleMedicines(now time.Time) []Medicine {
+        return []Medicine{
                 {
+                        SchemaVersion:    medicineSchemaVersion,
                         ID:               "1",
                         Name:             "Aspirin",
                         Manufacturer:     "ABC Pharmaceuticals",
-                        ManufactureDate:  "2022-01-01",
-                        ExpiryDate:       "2024-01-01",
+                        ManufactureDate:  time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+                        ExpiryDate:       time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
                         BrandName:        "PharmaCorp",
                         Composition:      "Acetylsalicylic Acid",
                         SenderID:         "Sender1",
                         ReceiverID:       "Receiver1",
                         DRAPNo:           "1",
                         DosageForm:       "Tablet",
-                        TimeStamp:        "Pain Reliever",
+                        TimeStamp:        now,
                         Batch_No:         "BatchNo1",
-                        JourneyCompleted: "false",
+                        GTIN:             "8960000000016",
+                        State:            StateReleased,
+                        JourneyCompleted: false,
                 },
                 {
+                        SchemaVersion:    medicineSchemaVersion,
                         ID:               "2",
                         Name:             "Paracetamol",
                         Manufacturer:     "XYZ Pharmaceuticals",
-                        ManufactureDate:  "2022-02-01",
-                        ExpiryDate:       "2024-02-01",
+                        ManufactureDate:  time.Date(2022, time.February, 1, 0, 0, 0, 0, time.UTC),
+                        ExpiryDate:       time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
                         BrandName:        "HealthCare",
                         Composition:      "Paracetamol",
                         SenderID:         "Sender2",
                         ReceiverID:       "Receiver2",
                         DRAPNo:           "2",
                         DosageForm:       "Tablet",
-                        TimeStamp:        "Fever Reducer",
+                        TimeStamp:        now,
                         Batch_No:         "BatchNo2",
-                        JourneyCompleted: "false",
+                        GTIN:             "8960000000023",
+                        State:            StateReleased,
+                        JourneyCompleted: false,
                 },
 
                 {
+                        SchemaVersion:    medicineSchemaVersion,
                         ID:               "3",
                         Name:             "Ibuprofen",
                         Manufacturer:     "PQR Pharmaceuticals",
-                        ManufactureDate:  "2022-03-01",
-                        ExpiryDate:       "2024-03-01",
+                        ManufactureDate:  time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC),
+                        ExpiryDate:       time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
                         BrandName:        "MediLife",
                         Composition:      "Ibuprofen",
                         SenderID:         "Sender3",
                         ReceiverID:       "Receiver3",
                         DRAPNo:           "3",
                         DosageForm:       "Capsule",
-                        TimeStamp:        "Anti-inflammatory",
+                        TimeStamp:        now,
                         Batch_No:         "BatchNo3",
-                        JourneyCompleted: "false",
+                        GTIN:             "8960000000030",
+                        State:            StateReleased,
+                        JourneyCompleted: false,
                 },
 
                 {
+                        SchemaVersion:    medicineSchemaVersion,
                         ID:               "4",
                         Name:             "Amoxicillin",
                         Manufacturer:     "LMN Pharmaceuticals",
-                        ManufactureDate:  "2022-04-01",
-                        ExpiryDate:       "2024-04-01",
+                        ManufactureDate:  time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC),
+                        ExpiryDate:       time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
                         BrandName:        "PharmaMed",
                         Composition:      "Amoxicillin",
                         SenderID:         "Sender4",
                         ReceiverID:       "Receiver4",
                         DRAPNo:           "4",
                         DosageForm:       "Tablet",
-                        TimeStamp:        "Antibiotic",
+                        TimeStamp:        now,
                         Batch_No:         "BatchNo4",
-                        JourneyCompleted: "false",
+                        GTIN:             "8960000000047",
+                        State:            StateReleased,
+                        JourneyCompleted: false,
                 },
                 {
+                        SchemaVersion:    medicineSchemaVersion,
                         ID:               "5",
                         Name:             "Omeprazole",
                         Manufacturer:     "EFG Pharmaceuticals",
-                        ManufactureDate:  "2022-05-01",
-                        ExpiryDate:       "2024-05-01",
+                        ManufactureDate:  time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC),
+                        ExpiryDate:       time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
                         BrandName:        "PharmaCare",
                         Composition:      "Omeprazole",
                         SenderID:         "Sender5",
                         ReceiverID:       "Receiver5",
                         DRAPNo:           "5",
                         DosageForm:       "Capsule",
-                        TimeStamp:        "Acid Reducer",
+                        TimeStamp:        now,
                         Batch_No:         "BatchNo5",
-                        JourneyCompleted: "false",
+                        GTIN:             "8960000000054",
+                        State:            StateReleased,
+                        JourneyCompleted: false,
                 },
                 // Add more medicines here...
         }
+}
+
+// InitLedger adds a base set of medicines to the ledger. Medicines and products
+// that already exist, and IDs that were deleted, are skipped, so running it
+// again never rolls back a unit or its indexes. Creating or moving units of the
+// sample products requires their DRAP registrations and parties, which a
+// regulator loads with InitRegistry.
+func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+        err := authorize(ctx, ActionInitLedger)
+        if err != nil {
+                return err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+
+        medicines := sampleMedicines(now)
 
         for _, medicine := range medicines {
-                medicineJSON, err := json.Marshal(medicine)
+                exists, err := s.MedicineExists(ctx, medicine.ID)
+                if err != nil {
+                        return fmt.Errorf("failed to check medicine existence: %v", err)
+                }
+                retired, err := isRetired(ctx, medicine.ID)
+                if err != nil {
+                        return err
+                }
+                if exists || retired {
+                        continue
+                }
+
+                err = putMedicine(ctx, &medicine)
                 if err != nil {
-                        return fmt.Errorf("failed to marshal medicine JSON: %v", err)
+                        return err
                 }
 
-                err = ctx.GetStub().PutState(medicine.ID, medicineJSON)
+                err = putMedicineIndexes(ctx, &medicine)
                 if err != nil {
-                        return fmt.Errorf("failed to put medicine in world state: %v", err)
+                        return err
+                }
+        }
+
+        // Catalog the sample products so that further units can be created
+        // under them. Their DRAP registrations and parties are loaded by a
+        // regulator with InitRegistry.
+        for _, medicine := range medicines {
+                existing, err := getProduct(ctx, medicine.GTIN)
+                if err != nil {
+                        return err
+                }
+                if existing != nil {
+                        continue
+                }
+
+                err = putProduct(ctx, &Product{
+                        GTIN:         medicine.GTIN,
+                        Name:         medicine.Name,
+                        BrandName:    medicine.BrandName,
+                        Composition:  medicine.Composition,
+                        DosageForm:   medicine.DosageForm,
+                        Manufacturer: medicine.Manufacturer,
+                        DRAPNo:       medicine.DRAPNo,
+                })
+                if err != nil {
+                        return err
                 }
         }
 
@@ -135,50 +328,121 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 }
 
 // CreateMedicine issues a new medicine to the world state with the given details.
+// The medicine starts in the Manufactured state; timeStamp and journeyCompleted
+// are ignored since they are set by the chaincode.
 func (s *SmartContract) CreateMedicine(ctx contractapi.TransactionContextInterface, id string,
         name string, manufacturer string, manufactureDate string,
         expiryDate string, brandName string, composition string, senderID string,
         receiverID string, drApNo string, dosageForm string, timeStamp string, batch_No string, journeyCompleted string) error {
+        _, err := s.CreateMedicineJSON(ctx, MedicineInput{
+                ID:              id,
+                Name:            name,
+                Manufacturer:    manufacturer,
+                ManufactureDate: manufactureDate,
+                ExpiryDate:      expiryDate,
+                BrandName:       brandName,
+                Composition:     composition,
+                SenderID:        senderID,
+                ReceiverID:      receiverID,
+                DRAPNo:          drApNo,
+                DosageForm:      dosageForm,
+                TimeStamp:       timeStamp,
+                Batch_No:        batch_No,
+        })
+        return err
+}
+
+// CreateMedicineJSON issues a new medicine from a single JSON document, which
+// the contract API validates against the MedicineInput schema before the
+// transaction runs. Fields can be added to MedicineInput without changing the
+// transaction signature.
+func (s *SmartContract) CreateMedicineJSON(ctx contractapi.TransactionContextInterface, input MedicineInput) (*Medicine, error) {
+        err := authorize(ctx, ActionCreate)
+        if err != nil {
+                return nil, err
+        }
+
+        medicine, err := s.createMedicine(ctx, &input)
+        if err != nil {
+                return nil, err
+        }
 
-        exists, err := s.MedicineExists(ctx, id)
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineCreated, Medicine: medicine})
         if err != nil {
-                return fmt.Errorf("failed to check medicine existence: %v", err)
+                return nil, err
+        }
+
+        return medicine, nil
+}
+
+// createMedicine validates and writes a new medicine. The caller authorizes
+// the transaction and emits the event.
+func (s *SmartContract) createMedicine(ctx contractapi.TransactionContextInterface, input *MedicineInput) (*Medicine, error) {
+        exists, err := s.MedicineExists(ctx, input.ID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to check medicine existence: %v", err)
         }
         if exists {
-                return fmt.Errorf("the medicine %s already exists", id)
-        }
-
-        medicine := Medicine{
-                ID:               id,
-                Name:             name,
-                Manufacturer:     manufacturer,
-                ManufactureDate:  manufactureDate,
-                ExpiryDate:       expiryDate,
-                BrandName:        brandName,
-                Composition:      composition,
-                SenderID:         senderID,
-                ReceiverID:       receiverID,
-                DRAPNo:           drApNo,
-                DosageForm:       dosageForm,
-                TimeStamp:        timeStamp,
-                Batch_No:         batch_No,
-                JourneyCompleted: journeyCompleted,
-        }
-        medicineJSON, err := json.Marshal(medicine)
+                return nil, fmt.Errorf("the medicine %s already exists", input.ID)
+        }
+
+        retired, err := isRetired(ctx, input.ID)
         if err != nil {
-                return fmt.Errorf("failed to marshal medicine JSON: %v", err)
+                return nil, err
+        }
+        if retired {
+                return nil, fmt.Errorf("the medicine ID %s was deleted and cannot be re-used", input.ID)
         }
 
-        err = ctx.GetStub().PutState(id, medicineJSON)
+        err = checkBatchNotRecalled(ctx, input.Manufacturer, input.Batch_No)
         if err != nil {
-                return fmt.Errorf("failed to put medicine in world state: %v", err)
+                return nil, err
         }
 
-        return nil
+        medicine, err := newMedicine(ctx, input)
+        if err != nil {
+                return nil, err
+        }
+        err = applyProduct(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+        err = checkRegistration(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+        err = checkParticipant(ctx, medicine.SenderID)
+        if err != nil {
+                return nil, err
+        }
+        err = checkParticipant(ctx, medicine.ReceiverID)
+        if err != nil {
+                return nil, err
+        }
+        medicine.setState(StateManufactured)
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = putMedicineIndexes(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
 }
 
 // ReadMedicine returns the medicine stored in the world state with the given id.
+// A medicine whose batch is under an active recall is reported as Recalled, and
+// a unit referencing a catalog product is merged with the product's attributes.
 func (s *SmartContract) ReadMedicine(ctx contractapi.TransactionContextInterface, id string) (*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
         medicineJSON, err := ctx.GetStub().GetState(id)
         if err != nil {
                 return nil, fmt.Errorf("failed to read medicine from world state: %v", err)
@@ -187,65 +451,127 @@ func (s *SmartContract) ReadMedicine(ctx contractapi.TransactionContextInterface
                 return nil, fmt.Errorf("the medicine %s does not exist", id)
         }
 
-        var medicine Medicine
-        err = json.Unmarshal(medicineJSON, &medicine)
+        medicine, err := unmarshalMedicine(medicineJSON)
         if err != nil {
-                return nil, fmt.Errorf("failed to unmarshal medicine JSON: %v", err)
+                return nil, err
         }
 
-        return &medicine, nil
+        err = applyProduct(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = applyRecallStatus(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
 }
 
 // UpdateMedicine updates an existing medicine in the world state with the provided parameters.
+// The lifecycle state is kept; timeStamp and journeyCompleted are ignored since they
+// are set by the chaincode.
+// Identity and custody fields must match the stored record, and the medicine must
+// still match its DRAP registration; use PatchMedicine to change individual fields.
+// Only the medicine's manufacturer can update it, and not once it has left the
+// supply chain.
 func (s *SmartContract) UpdateMedicine(ctx contractapi.TransactionContextInterface,
         id string, name string, manufacturer string, manufactureDate string,
         expiryDate string, brandName string, composition string, senderID string,
         receiverID string, drApNo string, dosageForm string, timeStamp string, batch_No string, journeyCompleted string) error {
-        exists, err := s.MedicineExists(ctx, id)
+        _, err := s.UpdateMedicineJSON(ctx, MedicineInput{
+                ID:              id,
+                Name:            name,
+                Manufacturer:    manufacturer,
+                ManufactureDate: manufactureDate,
+                ExpiryDate:      expiryDate,
+                BrandName:       brandName,
+                Composition:     composition,
+                SenderID:        senderID,
+                ReceiverID:      receiverID,
+                DRAPNo:          drApNo,
+                DosageForm:      dosageForm,
+                TimeStamp:       timeStamp,
+                Batch_No:        batch_No,
+        })
+        return err
+}
+
+// UpdateMedicineJSON replaces an existing medicine with a single JSON
+// document validated against the MedicineInput schema, with the same rules as
+// UpdateMedicine.
+func (s *SmartContract) UpdateMedicineJSON(ctx contractapi.TransactionContextInterface, input MedicineInput) (*Medicine, error) {
+        err := authorize(ctx, ActionUpdate)
+        if err != nil {
+                return nil, err
+        }
+
+        previous, err := s.ReadMedicine(ctx, input.ID)
         if err != nil {
-                return fmt.Errorf("failed to check medicine existence: %v", err)
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
         }
-        if !exists {
-                return fmt.Errorf("the medicine %s does not exist", id)
+        if len(lifecycleTransitions[previous.State]) == 0 {
+                return nil, fmt.Errorf("the medicine %s is %s and can no longer be changed", input.ID, previous.State)
+        }
+        err = authorizeManufacturer(ctx, previous.Manufacturer)
+        if err != nil {
+                return nil, err
         }
 
-        medicine := Medicine{
-                ID:               id,
-                Name:             name,
-                Manufacturer:     manufacturer,
-                ManufactureDate:  manufactureDate,
-                ExpiryDate:       expiryDate,
-                BrandName:        brandName,
-                Composition:      composition,
-                SenderID:         senderID,
-                ReceiverID:       receiverID,
-                DRAPNo:           drApNo,
-                DosageForm:       dosageForm,
-                TimeStamp:        timeStamp,
-                Batch_No:         batch_No,
-                JourneyCompleted: journeyCompleted,
+        medicine, err := newMedicine(ctx, &input)
+        if err != nil {
+                return nil, err
         }
-        medicineJSON, err := json.Marshal(medicine)
+        err = applyProduct(ctx, medicine)
         if err != nil {
-                return fmt.Errorf("failed to marshal medicine JSON: %v", err)
+                return nil, err
+        }
+        err = checkIdentityUnchanged(previous, medicine)
+        if err != nil {
+                return nil, err
         }
+        err = checkRegistration(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+        medicine.setState(previous.State)
+        medicine.DecommissionReason = previous.DecommissionReason
+        medicine.DecommissionNote = previous.DecommissionNote
+        medicine.ContainerID = previous.ContainerID
+        medicine.ReturnReason = previous.ReturnReason
 
-        err = ctx.GetStub().PutState(id, medicineJSON)
+        err = putMedicine(ctx, medicine)
         if err != nil {
-                return fmt.Errorf("failed to put medicine in world state: %v", err)
+                return nil, err
         }
 
-        return nil
+        err = updateMedicineIndexes(ctx, previous, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineUpdated, Medicine: medicine})
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
 }
 
-// DeleteMedicine deletes a given medicine from the world state.
+// DeleteMedicine hard deletes a given medicine from the world state. It is
+// reserved for administrators correcting erroneous records; use
+// DecommissionMedicine to take a medicine out of the supply chain. The ID is
+// retired so that it can never be issued again.
 func (s *SmartContract) DeleteMedicine(ctx contractapi.TransactionContextInterface, id string) error {
-        exists, err := s.MedicineExists(ctx, id)
+        err := authorize(ctx, ActionDelete)
         if err != nil {
-                return fmt.Errorf("failed to check medicine existence: %v", err)
+                return err
         }
-        if !exists {
-                return fmt.Errorf("the medicine %s does not exist", id)
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return fmt.Errorf("failed to read medicine: %v", err)
         }
 
         err = ctx.GetStub().DelState(id)
@@ -253,11 +579,26 @@ func (s *SmartContract) DeleteMedicine(ctx contractapi.TransactionContextInterfa
                 return fmt.Errorf("failed to delete medicine from world state: %v", err)
         }
 
-        return nil
+        err = deleteMedicineIndexes(ctx, medicine)
+        if err != nil {
+                return err
+        }
+
+        err = retireID(ctx, id)
+        if err != nil {
+                return err
+        }
+
+        return emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineDeleted, Medicine: medicine})
 }
 
 // MedicineExists returns true when a medicine with the given ID exists in the world state.
 func (s *SmartContract) MedicineExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return false, err
+        }
+
         medicineJSON, err := ctx.GetStub().GetState(id)
         if err != nil {
                 return false, fmt.Errorf("failed to read medicine from world state: %v", err)
@@ -266,91 +607,86 @@ func (s *SmartContract) MedicineExists(ctx contractapi.TransactionContextInterfa
         return medicineJSON != nil, nil
 }
 
-// TransferMedicine updates the SenderId and RecieverId fields of a medicine with the given id in the world state, and returns the old owner.
+// TransferMedicine starts a custody handover of the medicine from senderId, which
+// must be its current holder, to receiverId. Custody only changes once the
+// receiver calls AcceptTransfer. Both parties must be active, licensed
+// participants in the registry.
 func (s *SmartContract) TransferMedicine(ctx contractapi.TransactionContextInterface, id string,
         senderId string, receiverId string) (string, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return "", err
+        }
+
         medicine, err := s.ReadMedicine(ctx, id)
 
         if err != nil {
                 return "", fmt.Errorf("failed to read medicine: %v", err)
         }
 
-        oldSenderId := medicine.SenderID
-        oldReceiverId := medicine.ReceiverID
-
-        medicine.SenderID = senderId
-        medicine.ReceiverID = receiverId
-
-        medicineJSON, err := json.Marshal(medicine)
-        if err != nil {
-                return "", fmt.Errorf("failed to marshal medicine JSON: %v", err)
+        if medicine.ReceiverID != senderId {
+                return "", fmt.Errorf("the medicine %s is held by %s, not %s", id, medicine.ReceiverID, senderId)
         }
 
-        err = ctx.GetStub().PutState(id, medicineJSON)
+        transfer, err := s.InitiateTransfer(ctx, id, receiverId)
         if err != nil {
-                return "", fmt.Errorf("failed to put medicine in world state: %v", err)
+                return "", err
         }
 
-        return fmt.Sprintf("Previous SenderId: %s, Previous ReceiverId: %s", oldSenderId, oldReceiverId), nil
+        return fmt.Sprintf("Transfer of medicine %s from %s to %s is pending acceptance", id, transfer.From, transfer.To), nil
 }
 
+// MedicineJourney used to move a medicine to Dispensed without recording who
+// dispensed it or to whom.
+//
+// Deprecated: use DispenseMedicine, which only the pharmacy holding the
+// medicine can call and which records the dispensation. MedicineJourney cannot
+// supply a patient reference, so it refuses every call.
 func (s *SmartContract) MedicineJourney(ctx contractapi.TransactionContextInterface, id string) (*Medicine, error) {
-        medicine, err := s.ReadMedicine(ctx, id)
-
-        if err != nil {
-                return medicine, fmt.Errorf("failed to read medicine: %v", err)
-        }
-
-        medicine.JourneyCompleted = "true"
-
-        medicineJSON, err := json.Marshal(medicine)
-        if err != nil {
-                return medicine, fmt.Errorf("failed to marshal medicine JSON: %v", err)
-        }
-
-        err = ctx.GetStub().PutState(id, medicineJSON)
-        if err != nil {
-                return medicine, fmt.Errorf("failed to put medicine in world state: %v", err)
-        }
-
-        return medicine, nil
+        return nil, fmt.Errorf("MedicineJourney is deprecated and no longer dispenses medicines, "+
+                "dispense medicine %s with DispenseMedicine(id, pharmacyId, patientRef) instead", id)
 }
 
 // GetAllMedicines returns all medicines found in the world state.
 func (s *SmartContract) GetAllMedicines(ctx contractapi.TransactionContextInterface) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
         resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
         if err != nil {
                 return nil, fmt.Errorf("failed to get medicines from world state: %v", err)
         }
         defer resultsIterator.Close()
 
-        var medicines []*Medicine
-        for resultsIterator.HasNext() {
-                queryResponse, err := resultsIterator.Next()
-                if err != nil {
-                        return nil, fmt.Errorf("failed to iterate over medicines: %v", err)
-                }
-
-                var medicine Medicine
-                err = json.Unmarshal(queryResponse.Value, &medicine)
-                if err != nil {
-                        return nil, fmt.Errorf("failed to unmarshal medicine JSON: %v", err)
-                }
-                medicines = append(medicines, &medicine)
-        }
+        return constructMedicinesFromIterator(ctx, resultsIterator)
+}
 
-        return medicines, nil
+// HistoryQueryResult is one committed change to a medicine. Record is omitted
+// when the change deleted the medicine.
+type HistoryQueryResult struct {
+        Record    *Medicine `json:"Record,omitempty" metadata:",optional"`
+        TxId      string    `json:"TxId"`
+        Timestamp time.Time `json:"Timestamp"`
+        IsDelete  bool      `json:"IsDelete"`
 }
 
-// GetMedicineHistory returns the history of changes for a medicine with the given ID.
-func (s *SmartContract) GetMedicineHistory(ctx contractapi.TransactionContextInterface, id string) ([]*Medicine, error) {
+// GetMedicineHistory returns the history of changes for a medicine with the given ID,
+// including deletions. Each version is merged with its catalog product as it is now.
+func (s *SmartContract) GetMedicineHistory(ctx contractapi.TransactionContextInterface, id string) ([]*HistoryQueryResult, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
         resultsIterator, err := ctx.GetStub().GetHistoryForKey(id)
         if err != nil {
                 return nil, fmt.Errorf("failed to get history for medicine: %v", err)
         }
         defer resultsIterator.Close()
 
-        var history []*Medicine
+        var history []*HistoryQueryResult
 
         for resultsIterator.HasNext() {
                 response, err := resultsIterator.Next()
@@ -358,13 +694,29 @@ func (s *SmartContract) GetMedicineHistory(ctx contractapi.TransactionContextInt
                         return nil, fmt.Errorf("failed to iterate history for medicine: %v", err)
                 }
 
-                var medicine Medicine
-                err = json.Unmarshal(response.Value, &medicine)
-                if err != nil {
-                        return nil, fmt.Errorf("failed to unmarshal history value for medicine: %v", err)
+                var medicine *Medicine
+                if !response.IsDelete && len(response.Value) > 0 {
+                        medicine, err = unmarshalMedicine(response.Value)
+                        if err != nil {
+                                return nil, fmt.Errorf("failed to unmarshal history value for medicine: %v", err)
+                        }
+                        err = applyProduct(ctx, medicine)
+                        if err != nil {
+                                return nil, err
+                        }
+                }
+
+                var timestamp time.Time
+                if response.Timestamp != nil {
+                        timestamp = time.Unix(response.Timestamp.GetSeconds(), int64(response.Timestamp.GetNanos())).UTC()
                 }
 
-                history = append(history, &medicine)
+                history = append(history, &HistoryQueryResult{
+                        Record:    medicine,
+                        TxId:      response.TxId,
+                        Timestamp: timestamp,
+                        IsDelete:  response.IsDelete,
+                })
         }
 
         return history, nil
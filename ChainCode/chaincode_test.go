@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestInitLedgerKeepsExistingMedicines(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        err := ledger.contract.InitLedger(ledger.as("Org2MSP", RoleRegulator, ""))
+        if err != nil {
+                t.Fatalf("failed to initialise the ledger: %v", err)
+        }
+        err = ledger.contract.InitRegistry(ledger.as("Org2MSP", RoleRegulator, ""))
+        if err != nil {
+                t.Fatalf("failed to initialise the registry: %v", err)
+        }
+        _, err = ledger.contract.PatchMedicine(ledger.as("Org1MSP", RoleManufacturer, "Sender1"), "1", `{"ExpiryDate":"2029-06-30"}`)
+        if err != nil {
+                t.Fatalf("failed to patch medicine 1: %v", err)
+        }
+        err = ledger.contract.DeleteMedicine(ledger.as("Org2MSP", RoleAdmin, ""), "2")
+        if err != nil {
+                t.Fatalf("failed to delete medicine 2: %v", err)
+        }
+
+        err = ledger.contract.InitLedger(ledger.as("Org2MSP", RoleRegulator, ""))
+        if err != nil {
+                t.Fatalf("failed to initialise the ledger again: %v", err)
+        }
+
+        medicine, err := ledger.contract.ReadMedicine(ledger.manufacturer(), "1")
+        if err != nil {
+                t.Fatalf("failed to read medicine 1: %v", err)
+        }
+        if medicine.ExpiryDate.Format(dateLayout) != "2029-06-30" {
+                t.Fatalf("expected medicine 1 to keep its patched expiry date, got %s", medicine.ExpiryDate.Format(dateLayout))
+        }
+        exists, err := ledger.contract.MedicineExists(ledger.manufacturer(), "2")
+        if err != nil {
+                t.Fatalf("failed to check medicine 2: %v", err)
+        }
+        if exists {
+                t.Fatalf("expected deleted medicine 2 not to be issued again")
+        }
+}
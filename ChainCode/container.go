@@ -0,0 +1,694 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ContainerType is the packaging level of a container.
+type ContainerType string
+
+// Container types, from the smallest to the largest.
+const (
+        ContainerBox    ContainerType = "box"
+        ContainerCase   ContainerType = "case"
+        ContainerPallet ContainerType = "pallet"
+)
+
+// containerLevels orders the container types. A container can only hold
+// containers of a lower level, which rules out cycles.
+var containerLevels = map[ContainerType]int{
+        ContainerBox:    1,
+        ContainerCase:   2,
+        ContainerPallet: 3,
+}
+
+// containerObjectType keys containers by ID.
+const containerObjectType = "container"
+
+// Container is a box, case or pallet holding units and smaller containers.
+// Units and Containers list the direct children only. A container that is
+// packed inside another has a ParentID and moves with its parent. PendingTo is
+// set while a transfer of the container awaits acceptance.
+type Container struct {
+        ID           string        `json:"ID"`
+        Type         ContainerType `json:"Type"`
+        Holder       string        `json:"Holder"`
+        ParentID     string        `json:"ParentId,omitempty" metadata:",optional"`
+        Units        []string      `json:"Units"`
+        Containers   []string      `json:"Containers"`
+        PendingTo    string        `json:"PendingTo,omitempty" metadata:",optional"`
+        Recalled     bool          `json:"Recalled"`
+        RecallReason string        `json:"RecallReason,omitempty" metadata:",optional"`
+        CreatedAt    time.Time     `json:"CreatedAt"`
+        TimeStamp    time.Time     `json:"TimeStamp"`
+        TxID         string        `json:"TxId"`
+}
+
+// CreateContainer creates an empty container held by the caller's participant.
+func (s *SmartContract) CreateContainer(ctx contractapi.TransactionContextInterface, id string, containerType string) (*Container, error) {
+        err := authorize(ctx, ActionPack)
+        if err != nil {
+                return nil, err
+        }
+
+        if id == "" {
+                return nil, fmt.Errorf("container ID must not be empty")
+        }
+        kind := ContainerType(containerType)
+        if _, ok := containerLevels[kind]; !ok {
+                return nil, fmt.Errorf("invalid container type %q, expected %s, %s or %s",
+                        containerType, ContainerBox, ContainerCase, ContainerPallet)
+        }
+
+        existing, err := getContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if existing != nil {
+                return nil, fmt.Errorf("the container %s already exists", id)
+        }
+
+        holder, err := getCallerParticipantID(ctx)
+        if err != nil {
+                return nil, err
+        }
+        err = checkParticipant(ctx, holder)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        container := &Container{
+                ID:         id,
+                Type:       kind,
+                Holder:     holder,
+                Units:      []string{},
+                Containers: []string{},
+                CreatedAt:  now,
+        }
+
+        err = putContainer(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// PackContainer puts units and smaller containers into a container. Every
+// child must be held by the container's holder, must not already be packed or
+// recalled, and units must be in a state they can be shipped from, so
+// manufactured units are released before they are packed.
+func (s *SmartContract) PackContainer(ctx contractapi.TransactionContextInterface, id string, childIds []string) (*Container, error) {
+        err := authorize(ctx, ActionPack)
+        if err != nil {
+                return nil, err
+        }
+
+        container, err := s.getOpenContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if len(childIds) == 0 {
+                return nil, fmt.Errorf("nothing to pack into container %s", id)
+        }
+
+        var unitIDs []string
+        for _, childID := range childIds {
+                if childID == id || containsID(container.Units, childID) || containsID(container.Containers, childID) {
+                        return nil, fmt.Errorf("%s cannot be packed into container %s twice", childID, id)
+                }
+
+                child, err := getContainer(ctx, childID)
+                if err != nil {
+                        return nil, err
+                }
+
+                if child != nil {
+                        switch {
+                        case child.Holder != container.Holder:
+                                return nil, fmt.Errorf("the container %s is held by %s, not %s", childID, child.Holder, container.Holder)
+                        case child.ParentID != "":
+                                return nil, fmt.Errorf("the container %s is already packed in %s", childID, child.ParentID)
+                        case child.Recalled:
+                                return nil, fmt.Errorf("the container %s is recalled: %s", childID, child.RecallReason)
+                        case child.PendingTo != "":
+                                return nil, fmt.Errorf("the container %s has a pending transfer to %s", childID, child.PendingTo)
+                        case containerLevels[child.Type] >= containerLevels[container.Type]:
+                                return nil, fmt.Errorf("a %s cannot be packed into a %s", child.Type, container.Type)
+                        }
+
+                        child.ParentID = id
+                        err = putContainer(ctx, child)
+                        if err != nil {
+                                return nil, err
+                        }
+                        container.Containers = append(container.Containers, childID)
+                        continue
+                }
+
+                medicine, err := s.ReadMedicine(ctx, childID)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to read medicine: %v", err)
+                }
+                switch {
+                case medicine.ReceiverID != container.Holder:
+                        return nil, fmt.Errorf("the medicine %s is held by %s, not %s", childID, medicine.ReceiverID, container.Holder)
+                case medicine.ContainerID != "":
+                        return nil, fmt.Errorf("the medicine %s is already packed in %s", childID, medicine.ContainerID)
+                case medicine.State == StateRecalled:
+                        return nil, fmt.Errorf("the medicine %s is recalled and cannot be packed", childID)
+                case medicine.State == StateManufactured:
+                        return nil, fmt.Errorf("the medicine %s is %s, release it before packing", childID, medicine.State)
+                case !canTransition(medicine.State, StateInTransit):
+                        return nil, fmt.Errorf("the medicine %s is %s and cannot be packed", childID, medicine.State)
+                }
+
+                medicine.ContainerID = id
+                err = putMedicine(ctx, medicine)
+                if err != nil {
+                        return nil, err
+                }
+                container.Units = append(container.Units, childID)
+                unitIDs = append(unitIDs, childID)
+        }
+
+        err = putContainer(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventContainerPacked, Container: container, Units: unitIDs})
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// UnpackContainer takes the given children out of a container, or every
+// child when none are given. The container itself is kept and can be reused.
+// A recalled container stays sealed until it is dealt with as a whole.
+func (s *SmartContract) UnpackContainer(ctx contractapi.TransactionContextInterface, id string, childIds []string) (*Container, error) {
+        err := authorize(ctx, ActionPack)
+        if err != nil {
+                return nil, err
+        }
+
+        container, err := s.getOpenContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+
+        if len(childIds) == 0 {
+                childIds = append(append([]string{}, container.Units...), container.Containers...)
+        }
+
+        var unitIDs []string
+        for _, childID := range childIds {
+                switch {
+                case containsID(container.Containers, childID):
+                        child, err := s.ReadContainer(ctx, childID)
+                        if err != nil {
+                                return nil, err
+                        }
+                        child.ParentID = ""
+                        err = putContainer(ctx, child)
+                        if err != nil {
+                                return nil, err
+                        }
+                        container.Containers = removeID(container.Containers, childID)
+                case containsID(container.Units, childID):
+                        medicine, err := s.ReadMedicine(ctx, childID)
+                        if err != nil {
+                                return nil, fmt.Errorf("failed to read medicine: %v", err)
+                        }
+                        medicine.ContainerID = ""
+                        err = putMedicine(ctx, medicine)
+                        if err != nil {
+                                return nil, err
+                        }
+                        container.Units = removeID(container.Units, childID)
+                        unitIDs = append(unitIDs, childID)
+                default:
+                        return nil, fmt.Errorf("%s is not packed in container %s", childID, id)
+                }
+        }
+
+        err = putContainer(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventContainerUnpacked, Container: container, Units: unitIDs})
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// TransferContainer offers custody of a container and everything inside it to
+// receiverId. Every unit gets a pending transfer in the same transaction, so
+// either all of them move InTransit or none do. Only an outermost container
+// can be transferred.
+func (s *SmartContract) TransferContainer(ctx contractapi.TransactionContextInterface, id string, receiverId string) (*Container, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        container, err := s.getOpenContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if container.ParentID != "" {
+                return nil, fmt.Errorf("the container %s is packed in %s, transfer that instead", id, container.ParentID)
+        }
+        err = checkTransferParties(ctx, container.Holder, receiverId)
+        if err != nil {
+                return nil, err
+        }
+
+        units, _, err := s.containerContents(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        unitIDs := make([]string, 0, len(units))
+        for _, medicine := range units {
+                _, err = startTransfer(ctx, medicine, receiverId, id)
+                if err != nil {
+                        return nil, err
+                }
+                unitIDs = append(unitIDs, medicine.ID)
+        }
+
+        container.PendingTo = receiverId
+        err = putContainer(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventContainerTransferInitiated, Container: container, Units: unitIDs})
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// AcceptContainerTransfer completes the pending transfer of a container. Only
+// the named recipient can accept, after which it holds the container, every
+// container inside it and every unit.
+func (s *SmartContract) AcceptContainerTransfer(ctx contractapi.TransactionContextInterface, id string) (*Container, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        container, err := s.getPendingContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = authorizeParticipant(ctx, container.PendingTo)
+        if err != nil {
+                return nil, err
+        }
+        err = checkTransferParties(ctx, container.Holder, container.PendingTo)
+        if err != nil {
+                return nil, err
+        }
+
+        _, role, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+        state, err := holdingState(role)
+        if err != nil {
+                return nil, err
+        }
+
+        unitIDs, err := s.resolveContainerTransfer(ctx, container, true, func(transfer *Transfer) error {
+                _, err := s.completeTransfer(ctx, transfer, state)
+                return err
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventContainerTransferred, Container: container, Units: unitIDs})
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// RejectContainerTransfer declines the pending transfer of a container. Only
+// the named recipient can reject; custody stays with the sender.
+func (s *SmartContract) RejectContainerTransfer(ctx contractapi.TransactionContextInterface, id string, reason string) (*Container, error) {
+        return s.returnContainer(ctx, id, reason, TransferRejected, EventContainerTransferRejected)
+}
+
+// CancelContainerTransfer withdraws the pending transfer of a container. Only
+// the sender that initiated it can cancel.
+func (s *SmartContract) CancelContainerTransfer(ctx contractapi.TransactionContextInterface, id string, reason string) (*Container, error) {
+        return s.returnContainer(ctx, id, reason, TransferCancelled, EventContainerTransferCancelled)
+}
+
+// RecallContainer recalls everything inside a container in one transaction.
+// Units that can still move are moved to the Recalled state, and a pending
+// transfer of the container is cancelled.
+func (s *SmartContract) RecallContainer(ctx contractapi.TransactionContextInterface, id string, reason string) (*Container, error) {
+        err := authorize(ctx, ActionRecall)
+        if err != nil {
+                return nil, err
+        }
+
+        if reason == "" {
+                return nil, fmt.Errorf("a reason is required to recall container %s", id)
+        }
+        container, err := s.ReadContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if container.Recalled {
+                return nil, fmt.Errorf("the container %s is already recalled", id)
+        }
+
+        if container.PendingTo != "" {
+                _, err = s.resolveContainerTransfer(ctx, container, false, func(transfer *Transfer) error {
+                        return resolveTransfer(ctx, transfer, TransferCancelled, reason)
+                })
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        units, containers, err := s.containerContents(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        var unitIDs []string
+        for _, medicine := range units {
+                if !canTransition(medicine.State, StateRecalled) {
+                        continue
+                }
+                err = medicine.transitionTo(StateRecalled)
+                if err != nil {
+                        return nil, err
+                }
+                medicine.TimeStamp = now
+                err = putMedicine(ctx, medicine)
+                if err != nil {
+                        return nil, err
+                }
+                unitIDs = append(unitIDs, medicine.ID)
+        }
+
+        for _, packed := range containers {
+                packed.Recalled = true
+                packed.RecallReason = reason
+                err = putContainer(ctx, packed)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventContainerRecalled, Container: container, Units: unitIDs})
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// ReadContainer returns the container with the given ID.
+func (s *SmartContract) ReadContainer(ctx contractapi.TransactionContextInterface, id string) (*Container, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        container, err := getContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if container == nil {
+                return nil, fmt.Errorf("the container %s does not exist", id)
+        }
+
+        return container, nil
+}
+
+// GetContainerUnits returns every unit inside a container, including those in
+// the containers packed inside it.
+func (s *SmartContract) GetContainerUnits(ctx contractapi.TransactionContextInterface, id string) ([]*Medicine, error) {
+        container, err := s.ReadContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+
+        units, _, err := s.containerContents(ctx, container)
+        return units, err
+}
+
+// returnContainer rejects or cancels the pending transfer of a container,
+// returning every unit to the state it was in with the sender.
+func (s *SmartContract) returnContainer(ctx contractapi.TransactionContextInterface,
+        id string, reason string, status TransferStatus, eventType string) (*Container, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        container, err := s.getPendingContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if status == TransferRejected {
+                err = authorizeParticipant(ctx, container.PendingTo)
+        } else {
+                err = authorizeParticipant(ctx, container.Holder)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        unitIDs, err := s.resolveContainerTransfer(ctx, container, false, func(transfer *Transfer) error {
+                err := s.returnToHolder(ctx, transfer)
+                if err != nil {
+                        return err
+                }
+                return resolveTransfer(ctx, transfer, status, reason)
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: eventType, Container: container, Units: unitIDs})
+        if err != nil {
+                return nil, err
+        }
+
+        return container, nil
+}
+
+// resolveContainerTransfer applies resolve to the pending transfer of every
+// unit in a container and clears the container's PendingTo. An accepted
+// transfer also hands the container and every container inside it to the
+// recipient. It returns the IDs of the units whose transfers were resolved.
+func (s *SmartContract) resolveContainerTransfer(ctx contractapi.TransactionContextInterface,
+        container *Container, accepted bool, resolve func(transfer *Transfer) error) ([]string, error) {
+        units, containers, err := s.containerContents(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        var unitIDs []string
+        for _, medicine := range units {
+                transfer, err := getTransfer(ctx, medicine.ID)
+                if err != nil {
+                        return nil, err
+                }
+                if transfer == nil || transfer.Status != TransferPending || transfer.ContainerID != container.ID {
+                        continue
+                }
+
+                err = resolve(transfer)
+                if err != nil {
+                        return nil, err
+                }
+                unitIDs = append(unitIDs, medicine.ID)
+        }
+
+        if accepted {
+                for _, packed := range containers[1:] {
+                        packed.Holder = container.PendingTo
+                        err = putContainer(ctx, packed)
+                        if err != nil {
+                                return nil, err
+                        }
+                }
+                container.Holder = container.PendingTo
+        }
+
+        container.PendingTo = ""
+        err = putContainer(ctx, container)
+        if err != nil {
+                return nil, err
+        }
+
+        return unitIDs, nil
+}
+
+// containerContents returns every unit inside a container and every container
+// in its tree, starting with the container itself.
+func (s *SmartContract) containerContents(ctx contractapi.TransactionContextInterface,
+        container *Container) ([]*Medicine, []*Container, error) {
+        var units []*Medicine
+        containers := []*Container{container}
+
+        for i := 0; i < len(containers); i++ {
+                for _, unitID := range containers[i].Units {
+                        medicine, err := s.ReadMedicine(ctx, unitID)
+                        if err != nil {
+                                return nil, nil, fmt.Errorf("failed to read medicine: %v", err)
+                        }
+                        units = append(units, medicine)
+                }
+                for _, childID := range containers[i].Containers {
+                        child, err := s.ReadContainer(ctx, childID)
+                        if err != nil {
+                                return nil, nil, err
+                        }
+                        containers = append(containers, child)
+                }
+        }
+
+        return units, containers, nil
+}
+
+// getOpenContainer returns a container the caller holds and may pack or
+// transfer: it must not be recalled or have a pending transfer.
+func (s *SmartContract) getOpenContainer(ctx contractapi.TransactionContextInterface, id string) (*Container, error) {
+        container, err := s.ReadContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+
+        err = authorizeParticipant(ctx, container.Holder)
+        if err != nil {
+                return nil, err
+        }
+        if container.Recalled {
+                return nil, fmt.Errorf("the container %s is recalled: %s", id, container.RecallReason)
+        }
+        if container.PendingTo != "" {
+                return nil, fmt.Errorf("the container %s has a pending transfer to %s", id, container.PendingTo)
+        }
+
+        return container, nil
+}
+
+// getPendingContainer returns a container with a pending transfer.
+func (s *SmartContract) getPendingContainer(ctx contractapi.TransactionContextInterface, id string) (*Container, error) {
+        container, err := s.ReadContainer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if container.PendingTo == "" {
+                return nil, fmt.Errorf("the container %s has no pending transfer", id)
+        }
+
+        return container, nil
+}
+
+// containsID reports whether ids contains id.
+func containsID(ids []string, id string) bool {
+        for _, candidate := range ids {
+                if candidate == id {
+                        return true
+                }
+        }
+
+        return false
+}
+
+// removeID returns ids without id.
+func removeID(ids []string, id string) []string {
+        remaining := make([]string, 0, len(ids))
+        for _, candidate := range ids {
+                if candidate != id {
+                        remaining = append(remaining, candidate)
+                }
+        }
+
+        return remaining
+}
+
+// getContainer returns a container, or nil if it does not exist.
+func getContainer(ctx contractapi.TransactionContextInterface, id string) (*Container, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(containerObjectType, []string{id})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create container key: %v", err)
+        }
+
+        containerJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read container from world state: %v", err)
+        }
+        if containerJSON == nil {
+                return nil, nil
+        }
+
+        var container Container
+        err = json.Unmarshal(containerJSON, &container)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal container JSON: %v", err)
+        }
+
+        return &container, nil
+}
+
+// putContainer stamps a container with the transaction and writes it.
+func putContainer(ctx contractapi.TransactionContextInterface, container *Container) error {
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        container.TimeStamp = now
+        container.TxID = ctx.GetStub().GetTxID()
+
+        key, err := ctx.GetStub().CreateCompositeKey(containerObjectType, []string{container.ID})
+        if err != nil {
+                return fmt.Errorf("failed to create container key: %v", err)
+        }
+
+        containerJSON, err := json.Marshal(container)
+        if err != nil {
+                return fmt.Errorf("failed to marshal container JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, containerJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put container in world state: %v", err)
+        }
+
+        return nil
+}
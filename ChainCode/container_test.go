@@ -0,0 +1,55 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestContainersRejectRecalledStock(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.releaseMedicine("M1")
+        other := medicineInput("M2")
+        other.Batch_No = "B2"
+        ledger.createMedicine(other)
+
+        for id, containerType := range map[string]ContainerType{"BOX1": ContainerBox, "CASE1": ContainerCase} {
+                _, err := ledger.contract.CreateContainer(ledger.manufacturer(), id, string(containerType))
+                if err != nil {
+                        t.Fatalf("failed to create %s: %v", id, err)
+                }
+        }
+        _, err := ledger.contract.PackContainer(ledger.manufacturer(), "BOX1", []string{"M2"})
+        if err == nil || !strings.Contains(err.Error(), "release it before packing") {
+                t.Fatalf("expected packing a manufactured unit to fail, got %v", err)
+        }
+        _, err = ledger.contract.ReleaseMedicine(ledger.manufacturer(), "M2")
+        if err != nil {
+                t.Fatalf("failed to release M2: %v", err)
+        }
+        _, err = ledger.contract.PackContainer(ledger.manufacturer(), "BOX1", []string{"M2"})
+        if err != nil {
+                t.Fatalf("failed to pack M2: %v", err)
+        }
+
+        _, err = ledger.contract.RecallBatch(ledger.as("Org2MSP", RoleRegulator, ""), "GSK", "B1", "contamination", string(RecallClassI))
+        if err != nil {
+                t.Fatalf("failed to recall B1: %v", err)
+        }
+        _, err = ledger.contract.PackContainer(ledger.manufacturer(), "BOX1", []string{"M1"})
+        if err == nil || !strings.Contains(err.Error(), "recalled") {
+                t.Fatalf("expected packing a recalled unit to fail, got %v", err)
+        }
+
+        _, err = ledger.contract.RecallContainer(ledger.as("Org2MSP", RoleRegulator, ""), "BOX1", "damaged seal")
+        if err != nil {
+                t.Fatalf("failed to recall BOX1: %v", err)
+        }
+        _, err = ledger.contract.UnpackContainer(ledger.manufacturer(), "BOX1", nil)
+        if err == nil || !strings.Contains(err.Error(), "recalled") {
+                t.Fatalf("expected unpacking a recalled container to fail, got %v", err)
+        }
+        _, err = ledger.contract.PackContainer(ledger.manufacturer(), "CASE1", []string{"BOX1"})
+        if err == nil || !strings.Contains(err.Error(), "recalled") {
+                t.Fatalf("expected packing a recalled container to fail, got %v", err)
+        }
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+        "fmt"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DecommissionReason is why a medicine was taken out of the supply chain.
+type DecommissionReason string
+
+// Decommission reasons.
+const (
+        DecommissionDestroyed DecommissionReason = "destroyed"
+        DecommissionLost      DecommissionReason = "lost"
+        DecommissionStolen    DecommissionReason = "stolen"
+        DecommissionSample    DecommissionReason = "sample"
+        DecommissionDamaged   DecommissionReason = "damaged"
+)
+
+// retiredObjectType marks IDs whose record was hard deleted, so that they can
+// never be issued again.
+const retiredObjectType = "retired"
+
+// DecommissionMedicine takes a medicine out of the supply chain for the given
+// reason. The record stays on the ledger, so its ID cannot be re-used. A
+// destroyed medicine moves to Destroyed, any other to Decommissioned. Only the
+// current holder or a regulator can decommission.
+func (s *SmartContract) DecommissionMedicine(ctx contractapi.TransactionContextInterface,
+        id string, reason string, note string) (*Medicine, error) {
+        err := authorize(ctx, ActionDecommission)
+        if err != nil {
+                return nil, err
+        }
+
+        decommissionReason := DecommissionReason(reason)
+        state := StateDecommissioned
+        switch decommissionReason {
+        case DecommissionDestroyed:
+                state = StateDestroyed
+        case DecommissionLost, DecommissionStolen, DecommissionSample, DecommissionDamaged:
+        default:
+                return nil, fmt.Errorf("invalid decommission reason %q, expected %s, %s, %s, %s or %s", reason,
+                        DecommissionDestroyed, DecommissionLost, DecommissionStolen, DecommissionSample, DecommissionDamaged)
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+
+        _, role, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+        if role != RoleRegulator {
+                err = authorizeParticipant(ctx, medicine.ReceiverID)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        err = medicine.transitionTo(state)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        medicine.DecommissionReason = decommissionReason
+        medicine.DecommissionNote = note
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineDecommissioned, Medicine: medicine})
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
+}
+
+// isRetired reports whether an ID belonged to a medicine that was hard deleted.
+func isRetired(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(retiredObjectType, []string{id})
+        if err != nil {
+                return false, fmt.Errorf("failed to create retired ID key: %v", err)
+        }
+
+        value, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return false, fmt.Errorf("failed to read retired ID from world state: %v", err)
+        }
+
+        return value != nil, nil
+}
+
+// retireID records that an ID must never be issued again.
+func retireID(ctx contractapi.TransactionContextInterface, id string) error {
+        key, err := ctx.GetStub().CreateCompositeKey(retiredObjectType, []string{id})
+        if err != nil {
+                return fmt.Errorf("failed to create retired ID key: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, []byte(ctx.GetStub().GetTxID()))
+        if err != nil {
+                return fmt.Errorf("failed to put retired ID in world state: %v", err)
+        }
+
+        return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+        "encoding/hex"
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// dispensationObjectType keys dispensations by medicine ID.
+const dispensationObjectType = "dispensation"
+
+// patientRefLength is the length of a hex encoded HMAC-SHA256 patient reference.
+const patientRefLength = 64
+
+// Dispensation records the handover of a medicine to a patient at the
+// pharmacy counter. PatientRef is an HMAC-SHA256 of the pharmacy's own patient
+// reference, keyed with a salt that never leaves the pharmacy, so the ledger
+// holds no personal data while the pharmacy can still find the patients who
+// received a recalled batch.
+type Dispensation struct {
+        MedicineID  string    `json:"MedicineId"`
+        PharmacyID  string    `json:"PharmacyId"`
+        PatientRef  string    `json:"PatientRef"`
+        DispensedAt time.Time `json:"DispensedAt"`
+        MSPID       string    `json:"MspId"`
+        TxID        string    `json:"TxId"`
+}
+
+// DispenseMedicine dispenses a medicine to a patient. pharmacyId must be the
+// pharmacy holding the medicine and patientRef the hex encoded salted HMAC of
+// the patient reference; plain references are refused. A medicine can only be
+// dispensed once, and never when it is recalled or expired. Dispensing ends
+// the medicine's journey and emits JourneyCompleted with the dispensation.
+func (s *SmartContract) DispenseMedicine(ctx contractapi.TransactionContextInterface,
+        id string, pharmacyId string, patientRef string) (*Dispensation, error) {
+        err := authorize(ctx, ActionDispense)
+        if err != nil {
+                return nil, err
+        }
+
+        err = checkPatientRef(patientRef)
+        if err != nil {
+                return nil, err
+        }
+
+        existing, err := getDispensation(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if existing != nil {
+                return nil, fmt.Errorf("the medicine %s was already dispensed by %s on %s",
+                        id, existing.PharmacyID, existing.DispensedAt.Format(dateLayout))
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+
+        err = authorizeParticipant(ctx, pharmacyId)
+        if err != nil {
+                return nil, err
+        }
+        if medicine.ReceiverID != pharmacyId {
+                return nil, fmt.Errorf("the medicine %s is held by %s, not %s", id, medicine.ReceiverID, pharmacyId)
+        }
+        if medicine.State != StateAtPharmacy {
+                return nil, fmt.Errorf("the medicine %s is %s, only medicines at a pharmacy can be dispensed", id, medicine.State)
+        }
+        if medicine.ContainerID != "" {
+                return nil, fmt.Errorf("the medicine %s is packed in container %s, unpack it before dispensing",
+                        id, medicine.ContainerID)
+        }
+
+        err = checkParticipant(ctx, pharmacyId)
+        if err != nil {
+                return nil, err
+        }
+        pharmacy, err := getParticipant(ctx, pharmacyId)
+        if err != nil {
+                return nil, err
+        }
+        if pharmacy.Type != ParticipantPharmacy && pharmacy.Type != ParticipantHospital {
+                return nil, fmt.Errorf("the participant %s is a %s, only pharmacies and hospitals dispense", pharmacyId, pharmacy.Type)
+        }
+
+        err = checkBatchNotRecalled(ctx, medicine.Manufacturer, medicine.Batch_No)
+        if err != nil {
+                return nil, err
+        }
+        err = checkNotExpired(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = medicine.transitionTo(StateDispensed)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+        medicine.TimeStamp = now
+
+        dispensation := &Dispensation{
+                MedicineID:  id,
+                PharmacyID:  pharmacyId,
+                PatientRef:  patientRef,
+                DispensedAt: now,
+                MSPID:       mspID,
+                TxID:        ctx.GetStub().GetTxID(),
+        }
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+        err = putDispensation(ctx, dispensation)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventJourneyCompleted, Medicine: medicine, Dispensation: dispensation})
+        if err != nil {
+                return nil, err
+        }
+
+        return dispensation, nil
+}
+
+// ReadDispensation returns the dispensation of a medicine.
+func (s *SmartContract) ReadDispensation(ctx contractapi.TransactionContextInterface, id string) (*Dispensation, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        dispensation, err := getDispensation(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if dispensation == nil {
+                return nil, fmt.Errorf("the medicine %s has not been dispensed", id)
+        }
+
+        return dispensation, nil
+}
+
+// checkPatientRef returns an error unless patientRef looks like a hex encoded
+// HMAC-SHA256, which keeps plain patient identifiers off the ledger.
+func checkPatientRef(patientRef string) error {
+        _, err := hex.DecodeString(patientRef)
+        if err != nil || len(patientRef) != patientRefLength {
+                return fmt.Errorf("the patient reference must be a hex encoded HMAC-SHA256 of %d characters, not a plain reference",
+                        patientRefLength)
+        }
+
+        return nil
+}
+
+// getDispensation returns the dispensation of a medicine, or nil if it has not been dispensed.
+func getDispensation(ctx contractapi.TransactionContextInterface, medicineID string) (*Dispensation, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(dispensationObjectType, []string{medicineID})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create dispensation key: %v", err)
+        }
+
+        dispensationJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read dispensation from world state: %v", err)
+        }
+        if dispensationJSON == nil {
+                return nil, nil
+        }
+
+        var dispensation Dispensation
+        err = json.Unmarshal(dispensationJSON, &dispensation)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal dispensation JSON: %v", err)
+        }
+
+        return &dispensation, nil
+}
+
+// putDispensation writes a dispensation under its medicine ID.
+func putDispensation(ctx contractapi.TransactionContextInterface, dispensation *Dispensation) error {
+        key, err := ctx.GetStub().CreateCompositeKey(dispensationObjectType, []string{dispensation.MedicineID})
+        if err != nil {
+                return fmt.Errorf("failed to create dispensation key: %v", err)
+        }
+
+        dispensationJSON, err := json.Marshal(dispensation)
+        if err != nil {
+                return fmt.Errorf("failed to marshal dispensation JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, dispensationJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put dispensation in world state: %v", err)
+        }
+
+        return nil
+}
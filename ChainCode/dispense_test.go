@@ -0,0 +1,75 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+const testPatientRef = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestDispenseMedicineRequiresHolder(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.deliverToPharmacy("M1", "PHARM1")
+
+        _, err := ledger.contract.DispenseMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM2"), "M1", "PHARM2", testPatientRef)
+        if err == nil || !strings.Contains(err.Error(), "is held by PHARM1") {
+                t.Fatalf("expected dispensing by a pharmacy that does not hold M1 to fail, got %v", err)
+        }
+        _, err = ledger.contract.DispenseMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM2"), "M1", "PHARM1", testPatientRef)
+        if err == nil {
+                t.Fatalf("expected PHARM2 acting as PHARM1 to be refused")
+        }
+
+        dispensation, err := ledger.contract.DispenseMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "PHARM1", testPatientRef)
+        if err != nil {
+                t.Fatalf("failed to dispense M1: %v", err)
+        }
+        if dispensation.PharmacyID != "PHARM1" || dispensation.PatientRef != testPatientRef {
+                t.Fatalf("unexpected dispensation %+v", dispensation)
+        }
+
+        medicine, err := ledger.contract.ReadMedicine(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to read M1: %v", err)
+        }
+        if medicine.State != StateDispensed {
+                t.Fatalf("expected M1 to be %s, got %s", StateDispensed, medicine.State)
+        }
+
+        _, err = ledger.contract.DispenseMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "PHARM1", testPatientRef)
+        if err == nil || !strings.Contains(err.Error(), "already dispensed") {
+                t.Fatalf("expected a second dispensation of M1 to fail, got %v", err)
+        }
+}
+
+func TestDispensingCompletesTheJourney(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.deliverToPharmacy("M1", "PHARM1")
+
+        _, err := ledger.contract.MedicineJourney(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1")
+        if err == nil || !strings.Contains(err.Error(), "DispenseMedicine") {
+                t.Fatalf("expected MedicineJourney to point to DispenseMedicine, got %v", err)
+        }
+
+        _, err = ledger.contract.DispenseMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "PHARM1", testPatientRef)
+        if err != nil {
+                t.Fatalf("failed to dispense M1: %v", err)
+        }
+        var eventName string
+        for len(ledger.stub.ChaincodeEventsChannel) > 0 {
+                eventName = (<-ledger.stub.ChaincodeEventsChannel).EventName
+        }
+        if eventName != EventJourneyCompleted {
+                t.Fatalf("expected dispensing to emit %s, got %s", EventJourneyCompleted, eventName)
+        }
+}
+
+func TestDispenseMedicineRefusesPlainPatientRef(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.deliverToPharmacy("M1", "PHARM1")
+
+        _, err := ledger.contract.DispenseMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "PHARM1", "CNIC-35202-1234567-1")
+        if err == nil {
+                t.Fatalf("expected a plain patient reference to be refused")
+        }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Chaincode event names. Fabric keeps a single event per transaction, so each
+// transaction emits the one event describing its outcome.
+const (
+        EventMedicineCreated            = "MedicineCreated"
+        EventMedicineUpdated            = "MedicineUpdated"
+        EventMedicineDeleted            = "MedicineDeleted"
+        EventMedicineDecommissioned     = "MedicineDecommissioned"
+        EventMedicineReleased           = "MedicineReleased"
+        EventTransferInitiated          = "TransferInitiated"
+        EventMedicineTransferred        = "MedicineTransferred"
+        EventTransferRejected           = "TransferRejected"
+        EventTransferCancelled          = "TransferCancelled"
+        EventJourneyCompleted           = "JourneyCompleted"
+        EventBatchRecalled              = "BatchRecalled"
+        EventRecallClosed               = "RecallClosed"
+        EventMedicineVerified           = "MedicineVerified"
+        EventContainerPacked            = "ContainerPacked"
+        EventContainerUnpacked          = "ContainerUnpacked"
+        EventContainerTransferInitiated = "ContainerTransferInitiated"
+        EventContainerTransferred       = "ContainerTransferred"
+        EventContainerTransferRejected  = "ContainerTransferRejected"
+        EventContainerTransferCancelled = "ContainerTransferCancelled"
+        EventContainerRecalled          = "ContainerRecalled"
+        EventMedicinesCreated           = "MedicinesCreated"
+        EventMedicinesTransferInitiated = "MedicinesTransferInitiated"
+        EventMedicinesExpired           = "MedicinesExpired"
+        EventReturnInitiated            = "ReturnInitiated"
+        EventReturnAcknowledged         = "ReturnAcknowledged"
+        EventReturnRejected             = "ReturnRejected"
+        EventReturnCancelled            = "ReturnCancelled"
+)
+
+// eventPayloadVersion is the version of the ChaincodeEvent payload format.
+// Consumers should ignore fields they do not know and reject newer major versions.
+const eventPayloadVersion = 1
+
+// ChaincodeEvent is the JSON payload of every event emitted by the chaincode.
+// Only the objects relevant to the event type are set. Units lists the
+// medicines a container or bulk event covers.
+type ChaincodeEvent struct {
+        Version      int           `json:"Version"`
+        Type         string        `json:"Type"`
+        MedicineID   string        `json:"MedicineId,omitempty"`
+        BatchNo      string        `json:"Batch_No,omitempty"`
+        TxID         string        `json:"TxId"`
+        Timestamp    time.Time     `json:"Timestamp"`
+        MSPID        string        `json:"MspId"`
+        Medicine     *Medicine     `json:"Medicine,omitempty"`
+        Transfer     *Transfer     `json:"Transfer,omitempty"`
+        Recall       *Recall       `json:"Recall,omitempty"`
+        Scan         *Scan         `json:"Scan,omitempty"`
+        Container    *Container    `json:"Container,omitempty"`
+        Units        []string      `json:"Units,omitempty"`
+        Dispensation *Dispensation `json:"Dispensation,omitempty"`
+        Return       *Return       `json:"Return,omitempty"`
+}
+
+// emitEvent completes the envelope of an event and sets it on the transaction.
+func emitEvent(ctx contractapi.TransactionContextInterface, event *ChaincodeEvent) error {
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+
+        event.Version = eventPayloadVersion
+        event.TxID = ctx.GetStub().GetTxID()
+        event.Timestamp = now
+        event.MSPID = mspID
+        if event.Medicine != nil && event.MedicineID == "" {
+                event.MedicineID = event.Medicine.ID
+        }
+
+        eventJSON, err := json.Marshal(event)
+        if err != nil {
+                return fmt.Errorf("failed to marshal %s event: %v", event.Type, err)
+        }
+
+        err = ctx.GetStub().SetEvent(event.Type, eventJSON)
+        if err != nil {
+                return fmt.Errorf("failed to set %s event: %v", event.Type, err)
+        }
+
+        return nil
+}
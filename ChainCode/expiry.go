@@ -0,0 +1,144 @@
+package main
+
+import (
+        "fmt"
+        "sort"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// isExpired reports whether a medicine has expired at the given time. A
+// medicine is usable up to and including its expiry date.
+func isExpired(medicine *Medicine, at time.Time) bool {
+        return !at.Before(medicine.ExpiryDate.AddDate(0, 0, 1))
+}
+
+// checkNotExpired returns an error if the medicine has expired at the
+// transaction timestamp, or if its expiry date is unknown.
+func checkNotExpired(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        if medicine.ExpiryDate.IsZero() {
+                return fmt.Errorf("the medicine %s has no valid expiry date", medicine.ID)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+
+        if isExpired(medicine, now) {
+                return fmt.Errorf("the medicine %s expired on %s", medicine.ID, medicine.ExpiryDate.Format(dateLayout))
+        }
+
+        return nil
+}
+
+// GetMedicinesExpiringBefore returns the stock still in the supply chain that
+// expires before the given date (YYYY-MM-DD), soonest first. With a holder
+// only that holder's stock is returned, using the holder index; without one
+// the whole ledger is searched, which requires CouchDB.
+func (s *SmartContract) GetMedicinesExpiringBefore(ctx contractapi.TransactionContextInterface,
+        date string, holder string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        before, err := parseDate(date)
+        if err != nil {
+                return nil, err
+        }
+
+        var candidates []*Medicine
+        if holder != "" {
+                candidates, err = s.getMedicinesByIndex(ctx, holderIndex, holder)
+        } else {
+                var queryString string
+                queryString, err = buildQueryString(
+                        fmt.Sprintf(`{"ExpiryDate":{"$lt":%q}}`, before.Format(time.RFC3339)), "ExpiryDate", "asc")
+                if err == nil {
+                        candidates, err = getQueryResultForQueryString(ctx, queryString)
+                }
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        var medicines []*Medicine
+        for _, medicine := range candidates {
+                if medicine.ExpiryDate.Before(before) && canTransition(medicine.State, StateExpired) {
+                        medicines = append(medicines, medicine)
+                }
+        }
+
+        sort.SliceStable(medicines, func(i, j int) bool {
+                return medicines[i].ExpiryDate.Before(medicines[j].ExpiryDate)
+        })
+
+        return medicines, nil
+}
+
+// ExpireMedicines moves a holder's stock that is past its expiry date to
+// Expired, taking it out of the supply chain, and returns the units it moved.
+// Units in transit are left for the holder that accepts them. Only the holder
+// or a regulator can run the sweep.
+func (s *SmartContract) ExpireMedicines(ctx contractapi.TransactionContextInterface, holder string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionDecommission)
+        if err != nil {
+                return nil, err
+        }
+
+        _, role, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+        if role != RoleRegulator {
+                err = authorizeParticipant(ctx, holder)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        candidates, err := s.getMedicinesByIndex(ctx, holderIndex, holder)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        medicines := []*Medicine{}
+        ids := []string{}
+        for _, medicine := range candidates {
+                if medicine.State == StateInTransit || !isExpired(medicine, now) {
+                        continue
+                }
+                if !canTransition(medicine.State, StateExpired) {
+                        continue
+                }
+
+                err = medicine.transitionTo(StateExpired)
+                if err != nil {
+                        return nil, err
+                }
+                medicine.TimeStamp = now
+
+                err = putMedicine(ctx, medicine)
+                if err != nil {
+                        return nil, err
+                }
+                medicines = append(medicines, medicine)
+                ids = append(ids, medicine.ID)
+        }
+
+        if len(ids) > 0 {
+                err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicinesExpired, Units: ids})
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        return medicines, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestExpireMedicines(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        expired := medicineInput("M1")
+        expired.ExpiryDate = "2025-01-01"
+        ledger.createMedicine(expired)
+        ledger.createMedicine(medicineInput("M2"))
+
+        _, err := ledger.contract.ExpireMedicines(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "MFG1")
+        if err == nil {
+                t.Fatalf("expected a sweep of another holder's stock to be refused")
+        }
+
+        medicines, err := ledger.contract.ExpireMedicines(ledger.manufacturer(), "MFG1")
+        if err != nil {
+                t.Fatalf("failed to expire stock of MFG1: %v", err)
+        }
+        if len(medicines) != 1 || medicines[0].ID != "M1" {
+                t.Fatalf("expected only M1 to expire, got %d medicines", len(medicines))
+        }
+
+        for id, state := range map[string]LifecycleState{"M1": StateExpired, "M2": StateManufactured} {
+                medicine, err := ledger.contract.ReadMedicine(ledger.manufacturer(), id)
+                if err != nil {
+                        t.Fatalf("failed to read %s: %v", id, err)
+                }
+                if medicine.State != state {
+                        t.Fatalf("expected %s to be %s, got %s", id, state, medicine.State)
+                }
+        }
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+        "fmt"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Composite-key secondary indexes. Each entry is keyed by the indexed value
+// and the medicine ID and holds no data, so lookups work on both LevelDB and
+// CouchDB peers without a rich query.
+const (
+        batchIndex        = "batch~id"
+        manufacturerIndex = "manufacturer~id"
+        holderIndex       = "holder~id"
+)
+
+// indexValue is stored under every index key, since a nil value would delete the key.
+var indexValue = []byte{0x00}
+
+// indexedValues returns the value a medicine is indexed under for each index.
+func indexedValues(medicine *Medicine) map[string]string {
+        return map[string]string{
+                batchIndex:        medicine.Batch_No,
+                manufacturerIndex: medicine.Manufacturer,
+                holderIndex:       medicine.ReceiverID,
+        }
+}
+
+// putMedicineIndexes adds the index entries for a newly written medicine.
+func putMedicineIndexes(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        return updateMedicineIndexes(ctx, nil, medicine)
+}
+
+// deleteMedicineIndexes removes the index entries of a deleted medicine.
+func deleteMedicineIndexes(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        return updateMedicineIndexes(ctx, medicine, nil)
+}
+
+// updateMedicineIndexes moves the index entries of a medicine from the values
+// in previous to the values in current. Either may be nil, and entries whose
+// value did not change are left untouched.
+func updateMedicineIndexes(ctx contractapi.TransactionContextInterface, previous *Medicine, current *Medicine) error {
+        oldValues := map[string]string{}
+        newValues := map[string]string{}
+        if previous != nil {
+                oldValues = indexedValues(previous)
+        }
+        if current != nil {
+                newValues = indexedValues(current)
+        }
+
+        for _, index := range []string{batchIndex, manufacturerIndex, holderIndex} {
+                if previous != nil && current != nil && oldValues[index] == newValues[index] {
+                        continue
+                }
+
+                if previous != nil && oldValues[index] != "" {
+                        key, err := ctx.GetStub().CreateCompositeKey(index, []string{oldValues[index], previous.ID})
+                        if err != nil {
+                                return fmt.Errorf("failed to create %s index key: %v", index, err)
+                        }
+                        err = ctx.GetStub().DelState(key)
+                        if err != nil {
+                                return fmt.Errorf("failed to delete %s index entry: %v", index, err)
+                        }
+                }
+
+                if current != nil && newValues[index] != "" {
+                        key, err := ctx.GetStub().CreateCompositeKey(index, []string{newValues[index], current.ID})
+                        if err != nil {
+                                return fmt.Errorf("failed to create %s index key: %v", index, err)
+                        }
+                        err = ctx.GetStub().PutState(key, indexValue)
+                        if err != nil {
+                                return fmt.Errorf("failed to put %s index entry: %v", index, err)
+                        }
+                }
+        }
+
+        return nil
+}
+
+// GetMedicinesByBatch returns every medicine with the given Batch_No.
+func (s *SmartContract) GetMedicinesByBatch(ctx contractapi.TransactionContextInterface, batchNo string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        return s.getMedicinesByIndex(ctx, batchIndex, batchNo)
+}
+
+// GetMedicinesByManufacturer returns every medicine produced by the given manufacturer.
+func (s *SmartContract) GetMedicinesByManufacturer(ctx contractapi.TransactionContextInterface, manufacturer string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        return s.getMedicinesByIndex(ctx, manufacturerIndex, manufacturer)
+}
+
+// GetMedicinesByHolder returns every medicine whose current ReceiverId is the
+// given holder, including returns; GetHolderInventory lists those separately.
+func (s *SmartContract) GetMedicinesByHolder(ctx contractapi.TransactionContextInterface, holder string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        return s.getMedicinesByIndex(ctx, holderIndex, holder)
+}
+
+// getMedicinesByIndex reads the medicines listed under value in a composite-key index.
+func (s *SmartContract) getMedicinesByIndex(ctx contractapi.TransactionContextInterface, index string, value string) ([]*Medicine, error) {
+        if value == "" {
+                return nil, fmt.Errorf("a value is required to look up the %s index", index)
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{value})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get %s index entries: %v", index, err)
+        }
+        defer resultsIterator.Close()
+
+        var medicines []*Medicine
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over %s index: %v", index, err)
+                }
+
+                _, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to split %s index key: %v", index, err)
+                }
+                if len(attributes) != 2 {
+                        return nil, fmt.Errorf("malformed %s index key %q", index, queryResponse.Key)
+                }
+
+                medicine, err := s.ReadMedicine(ctx, attributes[1])
+                if err != nil {
+                        return nil, err
+                }
+                medicines = append(medicines, medicine)
+        }
+
+        return medicines, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+        "crypto/x509"
+        "crypto/x509/pkix"
+        "encoding/json"
+        "fmt"
+        "sort"
+        "testing"
+
+        "github.com/hyperledger/fabric-chaincode-go/shim"
+        "github.com/hyperledger/fabric-chaincode-go/shimtest"
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+        "github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// testIdentity is the client identity of a test transaction.
+type testIdentity struct {
+        mspID      string
+        attributes map[string]string
+}
+
+func (i *testIdentity) GetID() (string, error) {
+        return i.attributes[participantAttribute], nil
+}
+
+func (i *testIdentity) GetMSPID() (string, error) {
+        return i.mspID, nil
+}
+
+func (i *testIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+        value, found := i.attributes[attrName]
+        return value, found, nil
+}
+
+func (i *testIdentity) AssertAttributeValue(attrName string, attrValue string) error {
+        if i.attributes[attrName] != attrValue {
+                return fmt.Errorf("attribute %s is not %s", attrName, attrValue)
+        }
+        return nil
+}
+
+func (i *testIdentity) GetX509Certificate() (*x509.Certificate, error) {
+        return &x509.Certificate{Subject: pkix.Name{
+                CommonName:   i.attributes[participantAttribute],
+                Organization: []string{i.mspID},
+        }}, nil
+}
+
+// couchStub adds rich queries and key history to the mock stub. Like CouchDB
+// it matches the selector against every JSON document in the world state,
+// including the documents stored under composite keys.
+type couchStub struct {
+        *shimtest.MockStub
+        history map[string][]*queryresult.KeyModification
+}
+
+func (s *couchStub) PutState(key string, value []byte) error {
+        err := s.MockStub.PutState(key, value)
+        if err != nil {
+                return err
+        }
+        s.history[key] = append(s.history[key], &queryresult.KeyModification{
+                TxId:      s.TxID,
+                Value:     value,
+                Timestamp: s.TxTimestamp,
+        })
+        return nil
+}
+
+func (s *couchStub) DelState(key string) error {
+        err := s.MockStub.DelState(key)
+        if err != nil {
+                return err
+        }
+        s.history[key] = append(s.history[key], &queryresult.KeyModification{
+                TxId:      s.TxID,
+                Timestamp: s.TxTimestamp,
+                IsDelete:  true,
+        })
+        return nil
+}
+
+func (s *couchStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+        return &historyIterator{modifications: append([]*queryresult.KeyModification{}, s.history[key]...)}, nil
+}
+
+func (s *couchStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+        var request struct {
+                Selector map[string]interface{} `json:"selector"`
+        }
+        err := json.Unmarshal([]byte(query), &request)
+        if err != nil {
+                return nil, fmt.Errorf("invalid query %s: %v", query, err)
+        }
+
+        keys := make([]string, 0, len(s.State))
+        for key := range s.State {
+                keys = append(keys, key)
+        }
+        sort.Strings(keys)
+
+        results := &queryIterator{}
+        for _, key := range keys {
+                var document map[string]interface{}
+                if json.Unmarshal(s.State[key], &document) != nil {
+                        continue
+                }
+
+                matches := true
+                for field, value := range request.Selector {
+                        if fmt.Sprint(document[field]) != fmt.Sprint(value) {
+                                matches = false
+                        }
+                }
+                if matches {
+                        results.kvs = append(results.kvs, &queryresult.KV{Key: key, Value: s.State[key]})
+                }
+        }
+
+        return results, nil
+}
+
+// queryIterator iterates over the results of a rich query.
+type queryIterator struct {
+        kvs []*queryresult.KV
+}
+
+func (it *queryIterator) HasNext() bool {
+        return len(it.kvs) > 0
+}
+
+func (it *queryIterator) Close() error {
+        return nil
+}
+
+func (it *queryIterator) Next() (*queryresult.KV, error) {
+        if len(it.kvs) == 0 {
+                return nil, fmt.Errorf("no more results")
+        }
+        kv := it.kvs[0]
+        it.kvs = it.kvs[1:]
+        return kv, nil
+}
+
+// historyIterator iterates over the history of a key, oldest change first.
+type historyIterator struct {
+        modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+        return len(it.modifications) > 0
+}
+
+func (it *historyIterator) Close() error {
+        return nil
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+        if len(it.modifications) == 0 {
+                return nil, fmt.Errorf("no more history")
+        }
+        modification := it.modifications[0]
+        it.modifications = it.modifications[1:]
+        return modification, nil
+}
+
+// testLedger runs transactions of the contract against a mock world state.
+type testLedger struct {
+        t        *testing.T
+        stub     *couchStub
+        contract *SmartContract
+        txCount  int
+}
+
+// newTestLedger returns a ledger with a registered product, DRAP-7, and the
+// participants MFG1 (GSK), MFG2, DIST1, PHARM1 and PHARM2, all bound to Org1MSP.
+func newTestLedger(t *testing.T) *testLedger {
+        ledger := &testLedger{
+                t: t,
+                stub: &couchStub{
+                        MockStub: shimtest.NewMockStub("medicine", nil),
+                        history:  map[string][]*queryresult.KeyModification{},
+                },
+                contract: &SmartContract{},
+        }
+
+        regulator := ledger.as("Org2MSP", RoleRegulator, "")
+        _, err := ledger.contract.RegisterDRAPProduct(regulator, "DRAP-7", "Panadol", "Paracetamol", "Tablet",
+                "500mg", "GSK", "2020-01-01", "2099-12-31")
+        if err != nil {
+                t.Fatalf("failed to register DRAP-7: %v", err)
+        }
+
+        for _, participant := range []Participant{
+                {ID: "MFG1", Name: "GSK", Type: ParticipantManufacturer},
+                {ID: "MFG2", Name: "Getz Pharma", Type: ParticipantManufacturer},
+                {ID: "DIST1", Name: "Distributor One", Type: ParticipantDistributor},
+                {ID: "PHARM1", Name: "Pharmacy One", Type: ParticipantPharmacy},
+                {ID: "PHARM2", Name: "Pharmacy Two", Type: ParticipantPharmacy},
+        } {
+                regulator = ledger.as("Org2MSP", RoleRegulator, "")
+                _, err = ledger.contract.RegisterParticipant(regulator, participant.ID, participant.Name,
+                        string(participant.Type), "LIC-"+participant.ID, "2099-12-31", "Org1MSP", "")
+                if err != nil {
+                        t.Fatalf("failed to register %s: %v", participant.ID, err)
+                }
+        }
+
+        return ledger
+}
+
+// as starts a new transaction submitted by a client of mspID with the given
+// role, bound to participantID unless it is empty.
+func (l *testLedger) as(mspID string, role Role, participantID string) contractapi.TransactionContextInterface {
+        l.txCount++
+        l.stub.MockTransactionStart(fmt.Sprintf("tx%d", l.txCount))
+        for len(l.stub.ChaincodeEventsChannel) > 0 {
+                <-l.stub.ChaincodeEventsChannel
+        }
+
+        attributes := map[string]string{roleAttribute: string(role)}
+        if participantID != "" {
+                attributes[participantAttribute] = participantID
+        }
+
+        ctx := &contractapi.TransactionContext{}
+        ctx.SetStub(l.stub)
+        ctx.SetClientIdentity(&testIdentity{mspID: mspID, attributes: attributes})
+        return ctx
+}
+
+// manufacturer starts a transaction submitted by MFG1.
+func (l *testLedger) manufacturer() contractapi.TransactionContextInterface {
+        return l.as("Org1MSP", RoleManufacturer, "MFG1")
+}
+
+// medicineInput returns a unit of DRAP-7 manufactured by MFG1 and held by it.
+func medicineInput(id string) MedicineInput {
+        return MedicineInput{
+                ID:              id,
+                Name:            "Panadol",
+                Manufacturer:    "GSK",
+                ManufactureDate: "2024-01-01",
+                ExpiryDate:      "2099-12-31",
+                BrandName:       "Panadol",
+                Composition:     "Paracetamol",
+                SenderID:        "MFG1",
+                ReceiverID:      "MFG1",
+                DRAPNo:          "DRAP-7",
+                DosageForm:      "Tablet",
+                Batch_No:        "B1",
+        }
+}
+
+// createMedicine issues a unit with the given input, failing the test on error.
+func (l *testLedger) createMedicine(input MedicineInput) *Medicine {
+        medicine, err := l.contract.CreateMedicineJSON(l.manufacturer(), input)
+        if err != nil {
+                l.t.Fatalf("failed to create medicine %s: %v", input.ID, err)
+        }
+        return medicine
+}
+
+// releaseMedicine issues a unit and releases it, failing the test on error.
+func (l *testLedger) releaseMedicine(id string) {
+        l.createMedicine(medicineInput(id))
+
+        _, err := l.contract.ReleaseMedicine(l.manufacturer(), id)
+        if err != nil {
+                l.t.Fatalf("failed to release medicine %s: %v", id, err)
+        }
+}
+
+// deliverToPharmacy issues a unit, releases it and moves it from MFG1 to
+// the pharmacy, failing the test on error.
+func (l *testLedger) deliverToPharmacy(id string, pharmacyID string) {
+        l.releaseMedicine(id)
+
+        _, err := l.contract.InitiateTransfer(l.manufacturer(), id, pharmacyID)
+        if err != nil {
+                l.t.Fatalf("failed to transfer medicine %s: %v", id, err)
+        }
+        _, err = l.contract.AcceptTransfer(l.as("Org1MSP", RolePharmacy, pharmacyID), id)
+        if err != nil {
+                l.t.Fatalf("failed to accept medicine %s: %v", id, err)
+        }
+}
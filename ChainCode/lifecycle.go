@@ -0,0 +1,134 @@
+package main
+
+import (
+        "fmt"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// LifecycleState is the position of a medicine in the supply chain.
+type LifecycleState string
+
+// Lifecycle states. Dispensed, Recalled, Destroyed, Decommissioned, Expired
+// and Returned are terminal for the supply chain: a medicine in one of them can
+// no longer move forward. Stock is only sent back up the chain through a
+// return, during which it is Returning, until its manufacturer acknowledges it.
+// Stock past its expiry date is moved to Expired by ExpireMedicines.
+const (
+        StateManufactured   LifecycleState = "Manufactured"
+        StateReleased       LifecycleState = "Released"
+        StateInTransit      LifecycleState = "InTransit"
+        StateAtDistributor  LifecycleState = "AtDistributor"
+        StateAtPharmacy     LifecycleState = "AtPharmacy"
+        StateDispensed      LifecycleState = "Dispensed"
+        StateRecalled       LifecycleState = "Recalled"
+        StateDestroyed      LifecycleState = "Destroyed"
+        StateExpired        LifecycleState = "Expired"
+        StateDecommissioned LifecycleState = "Decommissioned"
+        StateReturning      LifecycleState = "Returning"
+        StateReturned       LifecycleState = "Returned"
+)
+
+// lifecycleTransitions lists the states each state may move to. A transfer
+// that is rejected or cancelled returns an InTransit medicine to the state it
+// was in before, hence InTransit may move back to Released.
+var lifecycleTransitions = map[LifecycleState][]LifecycleState{
+        StateManufactured:   {StateReleased, StateRecalled, StateDestroyed, StateDecommissioned, StateExpired},
+        StateReleased:       {StateInTransit, StateRecalled, StateDestroyed, StateDecommissioned, StateExpired},
+        StateInTransit:      {StateReleased, StateAtDistributor, StateAtPharmacy, StateRecalled, StateDestroyed, StateDecommissioned, StateExpired},
+        StateAtDistributor:  {StateInTransit, StateRecalled, StateDestroyed, StateDecommissioned, StateExpired, StateReturning},
+        StateAtPharmacy:     {StateInTransit, StateDispensed, StateRecalled, StateDestroyed, StateDecommissioned, StateExpired, StateReturning},
+        StateDispensed:      {},
+        StateRecalled:       {StateDestroyed, StateDecommissioned, StateReturning},
+        StateDestroyed:      {},
+        StateDecommissioned: {},
+        StateExpired:        {StateDestroyed, StateDecommissioned, StateReturning},
+        StateReturning:      {StateReturned},
+        StateReturned:       {StateDestroyed, StateDecommissioned},
+}
+
+// canTransition reports whether a medicine may move from one state to another.
+func canTransition(from LifecycleState, to LifecycleState) bool {
+        for _, allowed := range lifecycleTransitions[from] {
+                if allowed == to {
+                        return true
+                }
+        }
+
+        return false
+}
+
+// transitionTo moves the medicine to a new lifecycle state, keeping the
+// derived JourneyCompleted flag in step.
+func (m *Medicine) transitionTo(state LifecycleState) error {
+        if !canTransition(m.State, state) {
+                return fmt.Errorf("the medicine %s cannot move from %s to %s", m.ID, m.State, state)
+        }
+
+        m.setState(state)
+        return nil
+}
+
+// setState sets the lifecycle state without validation. It is only used when
+// creating or upgrading records, and when a return that did not go ahead puts
+// a medicine back in the state it left.
+func (m *Medicine) setState(state LifecycleState) {
+        m.State = state
+        m.JourneyCompleted = state == StateDispensed
+}
+
+// holdingState returns the state a medicine is in once the given role holds it.
+func holdingState(role Role) (LifecycleState, error) {
+        switch role {
+        case RoleManufacturer:
+                return StateReleased, nil
+        case RoleDistributor:
+                return StateAtDistributor, nil
+        case RolePharmacy:
+                return StateAtPharmacy, nil
+        default:
+                return "", fmt.Errorf("a %s cannot hold medicines", role)
+        }
+}
+
+// ReleaseMedicine releases a manufactured medicine for distribution once it
+// has passed quality control. Only the manufacturer holding it can release it.
+func (s *SmartContract) ReleaseMedicine(ctx contractapi.TransactionContextInterface, id string) (*Medicine, error) {
+        err := authorize(ctx, ActionRelease)
+        if err != nil {
+                return nil, err
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+
+        err = authorizeParticipant(ctx, medicine.ReceiverID)
+        if err != nil {
+                return nil, err
+        }
+
+        err = medicine.transitionTo(StateReleased)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineReleased, Medicine: medicine})
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestReleaseMedicineRequiresHolder(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+
+        _, err := ledger.contract.ReleaseMedicine(ledger.as("Org1MSP", RoleManufacturer, "MFG2"), "M1")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected a release by a manufacturer that does not hold M1 to be refused, got %v", err)
+        }
+
+        medicine, err := ledger.contract.ReleaseMedicine(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to release M1: %v", err)
+        }
+        if medicine.State != StateReleased {
+                t.Fatalf("expected M1 to be %s, got %s", StateReleased, medicine.State)
+        }
+}
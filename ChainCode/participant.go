@@ -0,0 +1,296 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ParticipantType is the kind of organisation a participant is.
+type ParticipantType string
+
+// Participant types.
+const (
+        ParticipantManufacturer ParticipantType = "manufacturer"
+        ParticipantDistributor  ParticipantType = "distributor"
+        ParticipantPharmacy     ParticipantType = "pharmacy"
+        ParticipantHospital     ParticipantType = "hospital"
+)
+
+// ParticipantStatus is whether a participant may currently trade.
+type ParticipantStatus string
+
+// Participant statuses. Only active participants may send or receive medicines.
+const (
+        ParticipantActive    ParticipantStatus = "Active"
+        ParticipantSuspended ParticipantStatus = "Suspended"
+        ParticipantRevoked   ParticipantStatus = "Revoked"
+)
+
+// participantObjectType keys participants by the ID used as SenderId and ReceiverId.
+const participantObjectType = "participant"
+
+// Participant is a licensed organisation that can hold medicines. ID is the
+// value used as SenderId and ReceiverId, and the participantId certificate
+// attribute of its identities. Those identities must belong to MSPID.
+type Participant struct {
+        ID            string            `json:"ID"`
+        Name          string            `json:"Name"`
+        Type          ParticipantType   `json:"Type"`
+        LicenseNo     string            `json:"LicenseNo"`
+        LicenseExpiry time.Time         `json:"LicenseExpiry"`
+        MSPID         string            `json:"MspId"`
+        Address       string            `json:"Address"`
+        Status        ParticipantStatus `json:"Status"`
+        StatusReason  string            `json:"StatusReason,omitempty" metadata:",optional"`
+        UpdatedAt     time.Time         `json:"UpdatedAt"`
+        UpdatedBy     string            `json:"UpdatedBy"`
+        TxID          string            `json:"TxId"`
+}
+
+// RegisterParticipant adds a participant to the registry, or updates the
+// details and license of an existing one. New participants are Active; the
+// status of an existing participant is kept, so renewing a license does not
+// lift a suspension. licenseExpiry is YYYY-MM-DD.
+func (s *SmartContract) RegisterParticipant(ctx contractapi.TransactionContextInterface,
+        id string, name string, participantType string, licenseNo string, licenseExpiry string,
+        mspId string, address string) (*Participant, error) {
+        err := authorize(ctx, ActionRegister)
+        if err != nil {
+                return nil, err
+        }
+
+        if id == "" {
+                return nil, fmt.Errorf("a participant ID is required")
+        }
+        kind := ParticipantType(participantType)
+        switch kind {
+        case ParticipantManufacturer, ParticipantDistributor, ParticipantPharmacy, ParticipantHospital:
+        default:
+                return nil, fmt.Errorf("invalid participant type %q, expected %s, %s, %s or %s", participantType,
+                        ParticipantManufacturer, ParticipantDistributor, ParticipantPharmacy, ParticipantHospital)
+        }
+        if licenseNo == "" {
+                return nil, fmt.Errorf("a license number is required to register participant %s", id)
+        }
+        if mspId == "" {
+                return nil, fmt.Errorf("an MSP ID is required to register participant %s", id)
+        }
+        expires, err := parseDate(licenseExpiry)
+        if err != nil {
+                return nil, fmt.Errorf("invalid LicenseExpiry: %v", err)
+        }
+
+        existing, err := getParticipant(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+
+        participant := &Participant{
+                ID:            id,
+                Name:          name,
+                Type:          kind,
+                LicenseNo:     licenseNo,
+                LicenseExpiry: expires,
+                MSPID:         mspId,
+                Address:       address,
+                Status:        ParticipantActive,
+        }
+        if existing != nil {
+                participant.Status = existing.Status
+                participant.StatusReason = existing.StatusReason
+        }
+
+        err = stampParticipant(ctx, participant)
+        if err != nil {
+                return nil, err
+        }
+
+        err = putParticipant(ctx, participant)
+        if err != nil {
+                return nil, err
+        }
+
+        return participant, nil
+}
+
+// SetParticipantStatus suspends, revokes or reinstates a participant. A reason
+// is required unless the participant is reinstated.
+func (s *SmartContract) SetParticipantStatus(ctx contractapi.TransactionContextInterface,
+        id string, status string, reason string) (*Participant, error) {
+        err := authorize(ctx, ActionRegister)
+        if err != nil {
+                return nil, err
+        }
+
+        participantStatus := ParticipantStatus(status)
+        switch participantStatus {
+        case ParticipantActive:
+                reason = ""
+        case ParticipantSuspended, ParticipantRevoked:
+                if reason == "" {
+                        return nil, fmt.Errorf("a reason is required to mark participant %s as %s", id, status)
+                }
+        default:
+                return nil, fmt.Errorf("invalid participant status %q, expected %s, %s or %s", status,
+                        ParticipantActive, ParticipantSuspended, ParticipantRevoked)
+        }
+
+        participant, err := s.ReadParticipant(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+
+        participant.Status = participantStatus
+        participant.StatusReason = reason
+        err = stampParticipant(ctx, participant)
+        if err != nil {
+                return nil, err
+        }
+
+        err = putParticipant(ctx, participant)
+        if err != nil {
+                return nil, err
+        }
+
+        return participant, nil
+}
+
+// ReadParticipant returns the registry entry for a participant.
+func (s *SmartContract) ReadParticipant(ctx contractapi.TransactionContextInterface, id string) (*Participant, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        participant, err := getParticipant(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if participant == nil {
+                return nil, fmt.Errorf("the participant %s is not in the participant registry", id)
+        }
+
+        return participant, nil
+}
+
+// GetParticipants returns every entry in the participant registry.
+func (s *SmartContract) GetParticipants(ctx contractapi.TransactionContextInterface) ([]*Participant, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(participantObjectType, []string{})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get participants from world state: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var participants []*Participant
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over participants: %v", err)
+                }
+
+                var participant Participant
+                err = json.Unmarshal(queryResponse.Value, &participant)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal participant JSON: %v", err)
+                }
+                participants = append(participants, &participant)
+        }
+
+        return participants, nil
+}
+
+// checkParticipant returns an error unless the participant is registered,
+// active and licensed at the time of the transaction. A license is valid up
+// to and including its expiry date.
+func checkParticipant(ctx contractapi.TransactionContextInterface, id string) error {
+        participant, err := getParticipant(ctx, id)
+        if err != nil {
+                return err
+        }
+        if participant == nil {
+                return fmt.Errorf("the participant %s is not in the participant registry", id)
+        }
+        if participant.Status != ParticipantActive {
+                return fmt.Errorf("the participant %s is %s: %s", id, participant.Status, participant.StatusReason)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        if !now.Before(participant.LicenseExpiry.AddDate(0, 0, 1)) {
+                return fmt.Errorf("the license %s of participant %s expired on %s",
+                        participant.LicenseNo, id, participant.LicenseExpiry.Format(dateLayout))
+        }
+
+        return nil
+}
+
+// stampParticipant records who changed a participant and when.
+func stampParticipant(ctx contractapi.TransactionContextInterface, participant *Participant) error {
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+
+        participant.UpdatedAt = now
+        participant.UpdatedBy = mspID
+        participant.TxID = ctx.GetStub().GetTxID()
+        return nil
+}
+
+// getParticipant returns a participant, or nil if it is not registered.
+func getParticipant(ctx contractapi.TransactionContextInterface, id string) (*Participant, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(participantObjectType, []string{id})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create participant key: %v", err)
+        }
+
+        participantJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read participant from world state: %v", err)
+        }
+        if participantJSON == nil {
+                return nil, nil
+        }
+
+        var participant Participant
+        err = json.Unmarshal(participantJSON, &participant)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal participant JSON: %v", err)
+        }
+
+        return &participant, nil
+}
+
+// putParticipant writes a participant.
+func putParticipant(ctx contractapi.TransactionContextInterface, participant *Participant) error {
+        key, err := ctx.GetStub().CreateCompositeKey(participantObjectType, []string{participant.ID})
+        if err != nil {
+                return fmt.Errorf("failed to create participant key: %v", err)
+        }
+
+        participantJSON, err := json.Marshal(participant)
+        if err != nil {
+                return fmt.Errorf("failed to marshal participant JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, participantJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put participant in world state: %v", err)
+        }
+
+        return nil
+}
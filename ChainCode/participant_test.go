@@ -0,0 +1,77 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestCreateMedicineRequiresActiveParticipants(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        unregistered := medicineInput("M1")
+        unregistered.ReceiverID = "DIST9"
+        _, err := ledger.contract.CreateMedicineJSON(ledger.manufacturer(), unregistered)
+        if err == nil || !strings.Contains(err.Error(), "not in the participant registry") {
+                t.Fatalf("expected a unit for an unregistered receiver to be refused, got %v", err)
+        }
+
+        _, err = ledger.contract.SetParticipantStatus(ledger.as("Org2MSP", RoleRegulator, ""), "DIST1",
+                string(ParticipantSuspended), "inspection pending")
+        if err != nil {
+                t.Fatalf("failed to suspend DIST1: %v", err)
+        }
+        suspended := medicineInput("M1")
+        suspended.ReceiverID = "DIST1"
+        _, err = ledger.contract.CreateMedicineJSON(ledger.manufacturer(), suspended)
+        if err == nil || !strings.Contains(err.Error(), "Suspended") {
+                t.Fatalf("expected a unit for a suspended receiver to be refused, got %v", err)
+        }
+}
+
+func TestUpdateAndPatchCannotChangeParticipants(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+
+        input := medicineInput("M1")
+        input.ReceiverID = "DIST1"
+        _, err := ledger.contract.UpdateMedicineJSON(ledger.manufacturer(), input)
+        if err == nil || !strings.Contains(err.Error(), "ReceiverId") {
+                t.Fatalf("expected an update of the receiver to be refused, got %v", err)
+        }
+
+        _, err = ledger.contract.PatchMedicine(ledger.manufacturer(), "M1", `{"SenderId":"DIST1"}`)
+        if err == nil || !strings.Contains(err.Error(), "SenderId") {
+                t.Fatalf("expected a patch of the sender to be refused, got %v", err)
+        }
+}
+
+func TestInitRegistryKeepsExistingParticipants(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        err := ledger.contract.InitRegistry(ledger.manufacturer())
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected a manufacturer to be refused, got %v", err)
+        }
+
+        err = ledger.contract.InitRegistry(ledger.as("Org2MSP", RoleRegulator, ""))
+        if err != nil {
+                t.Fatalf("failed to initialise the registry: %v", err)
+        }
+        _, err = ledger.contract.SetParticipantStatus(ledger.as("Org2MSP", RoleRegulator, ""), "Sender1",
+                string(ParticipantSuspended), "inspection pending")
+        if err != nil {
+                t.Fatalf("failed to suspend Sender1: %v", err)
+        }
+
+        err = ledger.contract.InitRegistry(ledger.as("Org2MSP", RoleRegulator, ""))
+        if err != nil {
+                t.Fatalf("failed to initialise the registry again: %v", err)
+        }
+        participant, err := ledger.contract.ReadParticipant(ledger.manufacturer(), "Sender1")
+        if err != nil {
+                t.Fatalf("failed to read Sender1: %v", err)
+        }
+        if participant.Status != ParticipantSuspended {
+                t.Fatalf("expected Sender1 to stay suspended, got %s", participant.Status)
+        }
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "sort"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// patchableFields lists the Medicine fields PatchMedicine may change and the
+// roles allowed to change each of them. Regulators may correct the expiry date
+// after a shelf-life decision, everything else belongs to the manufacturer.
+var patchableFields = map[string][]Role{
+        "Name":        {RoleManufacturer},
+        "BrandName":   {RoleManufacturer},
+        "Composition": {RoleManufacturer},
+        "DosageForm":  {RoleManufacturer},
+        "ExpiryDate":  {RoleManufacturer, RoleRegulator},
+}
+
+// immutableFields lists the fields that identify a medicine or are owned by
+// other transactions, and therefore can never be patched.
+var immutableFields = map[string]string{
+        "ID":                 "it identifies the medicine",
+        "SchemaVersion":      "it is set by the chaincode",
+        "Manufacturer":       "it is part of the medicine's identity",
+        "ManufactureDate":    "it is part of the medicine's identity",
+        "DrapNo":             "it is part of the medicine's identity",
+        "Batch_No":           "it is part of the medicine's identity",
+        "SenderId":           "custody changes through transfers",
+        "ReceiverId":         "custody changes through transfers",
+        "State":              "the lifecycle changes through its own transactions",
+        "JourneyCompleted":   "the lifecycle changes through its own transactions",
+        "DecommissionReason": "it is set by DecommissionMedicine",
+        "DecommissionNote":   "it is set by DecommissionMedicine",
+        "TimeStamp":          "it is set from the transaction timestamp",
+        "GTIN":               "it is part of the medicine's identity",
+        "ContainerId":        "it changes through PackContainer and UnpackContainer",
+        "SubmitterMspId":     "it is set by the chaincode",
+        "Submitter":          "it is set by the chaincode",
+        "ReturnReason":       "it is set by ReturnMedicine",
+}
+
+// catalogFields lists the patchable fields a unit takes from its product when
+// it references one. They are corrected with CorrectProduct instead.
+var catalogFields = map[string]bool{
+        "Name":        true,
+        "BrandName":   true,
+        "Composition": true,
+        "DosageForm":  true,
+}
+
+// PatchMedicine updates only the fields present in patchJSON, a JSON object
+// keyed by the Medicine JSON field names. The caller's role must be allowed to
+// change every field in the patch; identity fields are always rejected. A
+// manufacturer may only patch its own units. The patched medicine must still
+// match its DRAP registration.
+func (s *SmartContract) PatchMedicine(ctx contractapi.TransactionContextInterface, id string, patchJSON string) (*Medicine, error) {
+        mspID, role, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+        if role == "" {
+                return nil, &AuthorizationError{MSPID: mspID, Action: ActionUpdate}
+        }
+
+        var patch map[string]json.RawMessage
+        err = json.Unmarshal([]byte(patchJSON), &patch)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal patch JSON: %v", err)
+        }
+        if len(patch) == 0 {
+                return nil, fmt.Errorf("the patch for medicine %s does not change any field", id)
+        }
+
+        fields := make([]string, 0, len(patch))
+        for field := range patch {
+                fields = append(fields, field)
+        }
+        sort.Strings(fields)
+
+        for _, field := range fields {
+                if reason, ok := immutableFields[field]; ok {
+                        return nil, fmt.Errorf("the field %s cannot be patched, %s", field, reason)
+                }
+                roles, ok := patchableFields[field]
+                if !ok {
+                        return nil, fmt.Errorf("unknown medicine field %s", field)
+                }
+                if !hasRole(roles, role) {
+                        return nil, &AuthorizationError{
+                                MSPID:  mspID,
+                                Role:   role,
+                                Action: ActionUpdate,
+                                Reason: fmt.Sprintf("%s identity from %s may not change %s", role, mspID, field),
+                        }
+                }
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+        if len(lifecycleTransitions[medicine.State]) == 0 {
+                return nil, fmt.Errorf("the medicine %s is %s and can no longer be changed", id, medicine.State)
+        }
+        if role == RoleManufacturer {
+                err = authorizeManufacturer(ctx, medicine.Manufacturer)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        for _, field := range fields {
+                if medicine.GTIN != "" && catalogFields[field] {
+                        return nil, fmt.Errorf("the field %s of medicine %s comes from product %s, correct it in the catalog",
+                                field, id, medicine.GTIN)
+                }
+                err = applyPatchField(medicine, field, patch[field])
+                if err != nil {
+                        return nil, err
+                }
+        }
+        err = checkRegistration(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineUpdated, Medicine: medicine})
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
+}
+
+// applyPatchField sets a single patchable field from its JSON value.
+func applyPatchField(medicine *Medicine, field string, value json.RawMessage) error {
+        var text string
+        err := json.Unmarshal(value, &text)
+        if err != nil {
+                return fmt.Errorf("invalid value for %s, expected a string: %v", field, err)
+        }
+
+        switch field {
+        case "Name":
+                medicine.Name = text
+        case "BrandName":
+                medicine.BrandName = text
+        case "Composition":
+                medicine.Composition = text
+        case "DosageForm":
+                medicine.DosageForm = text
+        case "ExpiryDate":
+                expires, err := parseDate(text)
+                if err != nil {
+                        return fmt.Errorf("invalid ExpiryDate: %v", err)
+                }
+                if !expires.After(medicine.ManufactureDate) {
+                        return fmt.Errorf("ExpiryDate %s must be after ManufactureDate %s",
+                                expires.Format(dateLayout), medicine.ManufactureDate.Format(dateLayout))
+                }
+                medicine.ExpiryDate = expires
+        }
+
+        return nil
+}
+
+// checkIdentityUnchanged returns an error if a full update would change one
+// of the fields that identify a medicine or record its custody.
+func checkIdentityUnchanged(previous *Medicine, medicine *Medicine) error {
+        changed := func(field string) error {
+                return fmt.Errorf("the field %s of medicine %s cannot be changed, %s", field, previous.ID, immutableFields[field])
+        }
+
+        switch {
+        case medicine.Manufacturer != previous.Manufacturer:
+                return changed("Manufacturer")
+        case !sameDate(medicine.ManufactureDate, previous.ManufactureDate):
+                return changed("ManufactureDate")
+        case medicine.DRAPNo != previous.DRAPNo:
+                return changed("DrapNo")
+        case medicine.Batch_No != previous.Batch_No:
+                return changed("Batch_No")
+        case medicine.SenderID != previous.SenderID:
+                return changed("SenderId")
+        case medicine.ReceiverID != previous.ReceiverID:
+                return changed("ReceiverId")
+        case medicine.GTIN != previous.GTIN:
+                return changed("GTIN")
+        }
+
+        return nil
+}
+
+// sameDate reports whether two times fall on the same calendar day in UTC.
+func sameDate(a time.Time, b time.Time) bool {
+        return a.UTC().Format(dateLayout) == b.UTC().Format(dateLayout)
+}
+
+// hasRole reports whether role is one of roles.
+func hasRole(roles []Role, role Role) bool {
+        for _, allowed := range roles {
+                if allowed == role {
+                        return true
+                }
+        }
+
+        return false
+}
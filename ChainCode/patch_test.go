@@ -0,0 +1,77 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestPatchMedicineFieldRoles(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+
+        refused := []struct {
+                name      string
+                mspID     string
+                role      Role
+                callerID  string
+                patchJSON string
+        }{
+                {"distributor changing the expiry date", "Org1MSP", RoleDistributor, "DIST1", `{"ExpiryDate":"2098-12-31"}`},
+                {"regulator changing the brand name", "Org2MSP", RoleRegulator, "", `{"BrandName":"Panadol Extra"}`},
+                {"another manufacturer changing the expiry date", "Org1MSP", RoleManufacturer, "MFG2", `{"ExpiryDate":"2098-12-31"}`},
+                {"another manufacturer changing the brand name", "Org1MSP", RoleManufacturer, "MFG2", `{"BrandName":"Panadol Extra"}`},
+        }
+        for _, test := range refused {
+                _, err := ledger.contract.PatchMedicine(ledger.as(test.mspID, test.role, test.callerID), "M1", test.patchJSON)
+                if _, ok := err.(*AuthorizationError); !ok {
+                        t.Errorf("expected the %s to be refused, got %v", test.name, err)
+                }
+        }
+
+        for _, patchJSON := range []string{`{"Batch_No":"B9"}`, `{"ReceiverId":"DIST1"}`, `{"Colour":"red"}`, `{}`} {
+                _, err := ledger.contract.PatchMedicine(ledger.manufacturer(), "M1", patchJSON)
+                if err == nil {
+                        t.Errorf("expected the patch %s to be refused", patchJSON)
+                }
+        }
+
+        medicine, err := ledger.contract.PatchMedicine(ledger.as("Org2MSP", RoleRegulator, ""), "M1", `{"ExpiryDate":"2098-12-31"}`)
+        if err != nil {
+                t.Fatalf("failed to patch the expiry date as the regulator: %v", err)
+        }
+        if medicine.ExpiryDate.Format(dateLayout) != "2098-12-31" {
+                t.Fatalf("expected the expiry date to be patched, got %s", medicine.ExpiryDate.Format(dateLayout))
+        }
+        medicine, err = ledger.contract.PatchMedicine(ledger.manufacturer(), "M1", `{"BrandName":"Panadol Extra"}`)
+        if err != nil {
+                t.Fatalf("failed to patch the brand name as the manufacturer: %v", err)
+        }
+        if medicine.BrandName != "Panadol Extra" {
+                t.Fatalf("expected the brand name to be patched, got %s", medicine.BrandName)
+        }
+}
+
+func TestUpdateMedicineRequiresManufacturer(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+
+        input := medicineInput("M1")
+        input.BrandName = "Panadol Extra"
+        _, err := ledger.contract.UpdateMedicineJSON(ledger.as("Org1MSP", RoleManufacturer, "MFG2"), input)
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected an update by another manufacturer to be refused, got %v", err)
+        }
+
+        _, err = ledger.contract.DecommissionMedicine(ledger.manufacturer(), "M1", string(DecommissionLost), "")
+        if err != nil {
+                t.Fatalf("failed to decommission M1: %v", err)
+        }
+        _, err = ledger.contract.UpdateMedicineJSON(ledger.manufacturer(), input)
+        if err == nil || !strings.Contains(err.Error(), "can no longer be changed") {
+                t.Fatalf("expected an update of a decommissioned medicine to be refused, got %v", err)
+        }
+        _, err = ledger.contract.PatchMedicine(ledger.manufacturer(), "M1", `{"BrandName":"Panadol Extra"}`)
+        if err == nil || !strings.Contains(err.Error(), "can no longer be changed") {
+                t.Fatalf("expected a patch of a decommissioned medicine to be refused, got %v", err)
+        }
+}
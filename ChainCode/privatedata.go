@@ -0,0 +1,321 @@
+package main
+
+import (
+        "bytes"
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "fmt"
+        "sort"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// commercialTermsTransientKey is the transient map entry carrying the
+// commercial terms, so that they never appear in the transaction proposal.
+const commercialTermsTransientKey = "commercial_terms"
+
+// termsObjectType keys the public hash records by medicine and collection.
+const termsObjectType = "terms"
+
+// CommercialTerms holds the confidential terms agreed between two trading
+// partners for a medicine. Salt should be a random value chosen by the
+// submitter, so that the public hash cannot be brute-forced from likely prices.
+type CommercialTerms struct {
+        MedicineID       string  `json:"MedicineId"`
+        Seller           string  `json:"Seller"`
+        Buyer            string  `json:"Buyer"`
+        InvoicePrice     float64 `json:"InvoicePrice"`
+        Currency         string  `json:"Currency"`
+        Quantity         int     `json:"Quantity"`
+        QuantityDiscount float64 `json:"QuantityDiscount"`
+        ContractTerms    string  `json:"ContractTerms"`
+        Salt             string  `json:"Salt"`
+}
+
+// CommercialTermsRecord is the public record of private commercial terms. It
+// holds only the SHA-256 hash of the private value, which every channel member
+// can check with VerifyCommercialTerms.
+type CommercialTermsRecord struct {
+        MedicineID string    `json:"MedicineId"`
+        Collection string    `json:"Collection"`
+        Hash       string    `json:"Hash"`
+        TxID       string    `json:"TxId"`
+        RecordedAt time.Time `json:"RecordedAt"`
+}
+
+// tradingMSPs lists the organisations that trade medicines: the manufacturer,
+// distributor and pharmacy organisations. collections_config.json defines a
+// collection for every pair of them; the regulator has none.
+var tradingMSPs = map[string]bool{
+        "Org1MSP": true,
+        "Org3MSP": true,
+        "Org4MSP": true,
+}
+
+// tradingCollection returns the private data collection shared by two
+// organisations. The name does not depend on the order of the MSP IDs and
+// must match an entry in collections_config.json.
+func tradingCollection(mspID string, counterpartyMSPID string) (string, error) {
+        if counterpartyMSPID == "" || counterpartyMSPID == mspID {
+                return "", fmt.Errorf("a counterparty organisation other than %s is required", mspID)
+        }
+        for _, org := range []string{mspID, counterpartyMSPID} {
+                if !tradingMSPs[org] {
+                        return "", fmt.Errorf("%s does not trade medicines and has no commercial terms collection", org)
+                }
+        }
+
+        pair := []string{mspID, counterpartyMSPID}
+        sort.Strings(pair)
+        return fmt.Sprintf("terms_%s_%s", pair[0], pair[1]), nil
+}
+
+// callerTradingCollection returns the collection the caller's organisation
+// shares with the given counterparty.
+func callerTradingCollection(ctx contractapi.TransactionContextInterface, counterpartyMSPID string) (string, error) {
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return "", fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+
+        return tradingCollection(mspID, counterpartyMSPID)
+}
+
+// PutCommercialTerms stores the commercial terms passed in the transient map
+// under commercial_terms in the collection shared with counterpartyMSPID, and
+// records their hash on the public ledger. The caller and the counterparty must
+// be the seller and the buyer named in the terms, and both must be parties to
+// the medicine: its sender, its holder or the recipient of its pending transfer.
+func (s *SmartContract) PutCommercialTerms(ctx contractapi.TransactionContextInterface,
+        medicineID string, counterpartyMSPID string) (*CommercialTermsRecord, error) {
+        err := authorize(ctx, ActionTrade)
+        if err != nil {
+                return nil, err
+        }
+
+        medicine, err := s.ReadMedicine(ctx, medicineID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+
+        collection, err := callerTradingCollection(ctx, counterpartyMSPID)
+        if err != nil {
+                return nil, err
+        }
+
+        transientMap, err := ctx.GetStub().GetTransient()
+        if err != nil {
+                return nil, fmt.Errorf("failed to get transient data: %v", err)
+        }
+        termsJSON, ok := transientMap[commercialTermsTransientKey]
+        if !ok {
+                return nil, fmt.Errorf("the %s key was not found in the transient map", commercialTermsTransientKey)
+        }
+
+        var terms CommercialTerms
+        decoder := json.NewDecoder(bytes.NewReader(termsJSON))
+        decoder.DisallowUnknownFields()
+        err = decoder.Decode(&terms)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal commercial terms JSON: %v", err)
+        }
+        if terms.MedicineID != medicineID {
+                return nil, fmt.Errorf("the commercial terms are for medicine %s, not %s", terms.MedicineID, medicineID)
+        }
+        if terms.Seller == "" || terms.Buyer == "" {
+                return nil, fmt.Errorf("the commercial terms must name the seller and the buyer")
+        }
+        err = checkTradingParties(ctx, medicine, &terms, counterpartyMSPID)
+        if err != nil {
+                return nil, err
+        }
+        if terms.InvoicePrice < 0 || terms.Quantity < 0 || terms.QuantityDiscount < 0 {
+                return nil, fmt.Errorf("invoice price, quantity and discount must not be negative")
+        }
+
+        // Store the canonical encoding so that the public hash can be reproduced
+        privateJSON, err := json.Marshal(terms)
+        if err != nil {
+                return nil, fmt.Errorf("failed to marshal commercial terms JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutPrivateData(collection, medicineID, privateJSON)
+        if err != nil {
+                return nil, fmt.Errorf("failed to put commercial terms in collection %s: %v", collection, err)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        hash := sha256.Sum256(privateJSON)
+        record := &CommercialTermsRecord{
+                MedicineID: medicineID,
+                Collection: collection,
+                Hash:       hex.EncodeToString(hash[:]),
+                TxID:       ctx.GetStub().GetTxID(),
+                RecordedAt: now,
+        }
+
+        key, err := ctx.GetStub().CreateCompositeKey(termsObjectType, []string{medicineID, collection})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create commercial terms key: %v", err)
+        }
+        recordJSON, err := json.Marshal(record)
+        if err != nil {
+                return nil, fmt.Errorf("failed to marshal commercial terms record JSON: %v", err)
+        }
+        err = ctx.GetStub().PutState(key, recordJSON)
+        if err != nil {
+                return nil, fmt.Errorf("failed to put commercial terms record in world state: %v", err)
+        }
+
+        return record, nil
+}
+
+// checkTradingParties returns an error unless the caller is the seller or the
+// buyer named in the terms, the other one belongs to counterpartyMSPID, and
+// both are parties to the medicine.
+func checkTradingParties(ctx contractapi.TransactionContextInterface, medicine *Medicine,
+        terms *CommercialTerms, counterpartyMSPID string) error {
+        callerID, err := getCallerParticipantID(ctx)
+        if err != nil {
+                return err
+        }
+        err = authorizeParticipant(ctx, callerID)
+        if err != nil {
+                return err
+        }
+
+        var counterpartyID string
+        switch callerID {
+        case terms.Seller:
+                counterpartyID = terms.Buyer
+        case terms.Buyer:
+                counterpartyID = terms.Seller
+        default:
+                return fmt.Errorf("the commercial terms are between %s and %s, not %s", terms.Seller, terms.Buyer, callerID)
+        }
+        if counterpartyID == callerID {
+                return fmt.Errorf("the seller and the buyer must be different participants")
+        }
+
+        parties, err := medicineParties(ctx, medicine)
+        if err != nil {
+                return err
+        }
+        for _, id := range []string{callerID, counterpartyID} {
+                if !parties[id] {
+                        return fmt.Errorf("the participant %s is not a party to medicine %s", id, medicine.ID)
+                }
+        }
+
+        counterparty, err := getParticipant(ctx, counterpartyID)
+        if err != nil {
+                return err
+        }
+        if counterparty == nil {
+                return fmt.Errorf("the participant %s is not in the participant registry", counterpartyID)
+        }
+        if counterparty.MSPID != counterpartyMSPID {
+                return fmt.Errorf("the participant %s belongs to %s, not %s", counterpartyID, counterparty.MSPID, counterpartyMSPID)
+        }
+
+        return nil
+}
+
+// medicineParties returns the participants trading a medicine: its sender,
+// its holder and the recipient of its pending transfer, if any.
+func medicineParties(ctx contractapi.TransactionContextInterface, medicine *Medicine) (map[string]bool, error) {
+        parties := map[string]bool{medicine.SenderID: true, medicine.ReceiverID: true}
+
+        transfer, err := getTransfer(ctx, medicine.ID)
+        if err != nil {
+                return nil, err
+        }
+        if transfer != nil && transfer.Status == TransferPending {
+                parties[transfer.To] = true
+        }
+
+        return parties, nil
+}
+
+// ReadCommercialTerms returns the commercial terms for a medicine from the
+// collection the caller's organisation shares with counterpartyMSPID. It must
+// be evaluated on a peer of an organisation that is a member of the collection.
+func (s *SmartContract) ReadCommercialTerms(ctx contractapi.TransactionContextInterface,
+        medicineID string, counterpartyMSPID string) (*CommercialTerms, error) {
+        err := authorize(ctx, ActionTrade)
+        if err != nil {
+                return nil, err
+        }
+
+        collection, err := callerTradingCollection(ctx, counterpartyMSPID)
+        if err != nil {
+                return nil, err
+        }
+
+        termsJSON, err := ctx.GetStub().GetPrivateData(collection, medicineID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read commercial terms from collection %s: %v", collection, err)
+        }
+        if termsJSON == nil {
+                return nil, fmt.Errorf("no commercial terms for medicine %s in collection %s", medicineID, collection)
+        }
+
+        var terms CommercialTerms
+        err = json.Unmarshal(termsJSON, &terms)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal commercial terms JSON: %v", err)
+        }
+
+        return &terms, nil
+}
+
+// VerifyCommercialTerms reports whether the private commercial terms for a
+// medicine in the collection shared by two organisations still match the
+// hash on the public record. Any channel member can verify, since only the
+// private data hash is needed.
+func (s *SmartContract) VerifyCommercialTerms(ctx contractapi.TransactionContextInterface,
+        medicineID string, mspID string, counterpartyMSPID string) (bool, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return false, err
+        }
+
+        collection, err := tradingCollection(mspID, counterpartyMSPID)
+        if err != nil {
+                return false, err
+        }
+
+        key, err := ctx.GetStub().CreateCompositeKey(termsObjectType, []string{medicineID, collection})
+        if err != nil {
+                return false, fmt.Errorf("failed to create commercial terms key: %v", err)
+        }
+        recordJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return false, fmt.Errorf("failed to read commercial terms record from world state: %v", err)
+        }
+        if recordJSON == nil {
+                return false, fmt.Errorf("no commercial terms recorded for medicine %s in collection %s", medicineID, collection)
+        }
+
+        var record CommercialTermsRecord
+        err = json.Unmarshal(recordJSON, &record)
+        if err != nil {
+                return false, fmt.Errorf("failed to unmarshal commercial terms record JSON: %v", err)
+        }
+
+        privateHash, err := ctx.GetStub().GetPrivateDataHash(collection, medicineID)
+        if err != nil {
+                return false, fmt.Errorf("failed to read commercial terms hash from collection %s: %v", collection, err)
+        }
+        if privateHash == nil {
+                return false, nil
+        }
+
+        return hex.EncodeToString(privateHash) == record.Hash, nil
+}
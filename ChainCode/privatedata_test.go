@@ -0,0 +1,77 @@
+package main
+
+import (
+        "encoding/json"
+        "strings"
+        "testing"
+)
+
+// putTerms submits commercial terms for M1 between seller and buyer.
+func (l *testLedger) putTerms(mspID string, role Role, callerID string,
+        seller string, buyer string, counterpartyMSPID string) (*CommercialTermsRecord, error) {
+        ctx := l.as(mspID, role, callerID)
+        termsJSON, err := json.Marshal(&CommercialTerms{
+                MedicineID:   "M1",
+                Seller:       seller,
+                Buyer:        buyer,
+                InvoicePrice: 120,
+                Currency:     "PKR",
+                Quantity:     1,
+                Salt:         "5a1t",
+        })
+        if err != nil {
+                l.t.Fatalf("failed to marshal commercial terms: %v", err)
+        }
+        l.stub.TransientMap = map[string][]byte{commercialTermsTransientKey: termsJSON}
+
+        return l.contract.PutCommercialTerms(ctx, "M1", counterpartyMSPID)
+}
+
+func TestPutCommercialTermsRequiresParties(t *testing.T) {
+        ledger := newTestLedger(t)
+        for _, participant := range []Participant{
+                {ID: "DIST3", Type: ParticipantDistributor, MSPID: "Org3MSP"},
+                {ID: "PHARM4", Type: ParticipantPharmacy, MSPID: "Org4MSP"},
+        } {
+                _, err := ledger.contract.RegisterParticipant(ledger.as("Org2MSP", RoleRegulator, ""), participant.ID,
+                        participant.ID, string(participant.Type), "LIC-"+participant.ID, "2099-12-31", participant.MSPID, "")
+                if err != nil {
+                        t.Fatalf("failed to register %s: %v", participant.ID, err)
+                }
+        }
+
+        ledger.createMedicine(medicineInput("M1"))
+        _, err := ledger.contract.ReleaseMedicine(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to release M1: %v", err)
+        }
+        _, err = ledger.contract.InitiateTransfer(ledger.manufacturer(), "M1", "DIST3")
+        if err != nil {
+                t.Fatalf("failed to transfer M1: %v", err)
+        }
+
+        _, err = ledger.putTerms("Org1MSP", RoleManufacturer, "MFG1", "MFG1", "PHARM4", "Org4MSP")
+        if err == nil || !strings.Contains(err.Error(), "not a party") {
+                t.Fatalf("expected terms with a buyer that is not a party to be refused, got %v", err)
+        }
+        _, err = ledger.putTerms("Org4MSP", RolePharmacy, "PHARM4", "MFG1", "PHARM4", "Org1MSP")
+        if err == nil || !strings.Contains(err.Error(), "not a party") {
+                t.Fatalf("expected terms submitted by a participant that is not a party to be refused, got %v", err)
+        }
+        _, err = ledger.putTerms("Org1MSP", RoleManufacturer, "MFG1", "MFG1", "DIST3", "Org2MSP")
+        if err == nil {
+                t.Fatalf("expected terms shared with the regulator to be refused")
+        }
+        _, err = ledger.putTerms("Org1MSP", RoleManufacturer, "MFG1", "MFG1", "DIST3", "Org4MSP")
+        if err == nil || !strings.Contains(err.Error(), "belongs to Org3MSP") {
+                t.Fatalf("expected terms with a buyer from another organisation to be refused, got %v", err)
+        }
+
+        record, err := ledger.putTerms("Org1MSP", RoleManufacturer, "MFG1", "MFG1", "DIST3", "Org3MSP")
+        if err != nil {
+                t.Fatalf("failed to put commercial terms: %v", err)
+        }
+        if record.Collection != "terms_Org1MSP_Org3MSP" {
+                t.Fatalf("expected the terms in terms_Org1MSP_Org3MSP, got %s", record.Collection)
+        }
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+        "sort"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ProvenanceFlag marks a custody hop that does not follow from the one before it.
+type ProvenanceFlag string
+
+// Provenance flags. Unattributed only means the version was written before
+// the chaincode recorded submitters; it does not make the chain inconsistent.
+const (
+        ProvenanceCustodyGap        ProvenanceFlag = "CustodyGap"
+        ProvenanceUntrackedHandover ProvenanceFlag = "UntrackedHandover"
+        ProvenanceSubmitterMismatch ProvenanceFlag = "SubmitterMismatch"
+        ProvenanceDeleted           ProvenanceFlag = "Deleted"
+        ProvenanceUnattributed      ProvenanceFlag = "Unattributed"
+)
+
+// CustodyHop is a committed change of holder. From is the sender recorded
+// with the change, which should be the holder of the previous hop. Timestamp
+// is the timestamp of the transaction that committed the change, and the
+// submitter fields identify the client that signed it. ReturnReason is set on
+// hops that took a medicine back to its manufacturer.
+type CustodyHop struct {
+        Holder         string           `json:"Holder"`
+        From           string           `json:"From"`
+        State          LifecycleState   `json:"State"`
+        TxID           string           `json:"TxId"`
+        Timestamp      time.Time        `json:"Timestamp"`
+        SubmitterMSPID string           `json:"SubmitterMspId"`
+        Submitter      string           `json:"Submitter"`
+        ReturnReason   ReturnReason     `json:"ReturnReason,omitempty"`
+        Flags          []ProvenanceFlag `json:"Flags"`
+}
+
+// Provenance is the custody chain of a medicine, oldest hop first. Consistent
+// is false when any hop shows a gap, an untracked handover, a submitter that
+// does not belong to the receiving participant or a deletion.
+type Provenance struct {
+        MedicineID string        `json:"MedicineId"`
+        Hops       []*CustodyHop `json:"Hops"`
+        Consistent bool          `json:"Consistent"`
+}
+
+// GetMedicineProvenance returns the custody chain of a medicine from its
+// committed history: one hop for its creation and one for every change of
+// holder, each with the transaction that made it and the client that signed it.
+func (s *SmartContract) GetMedicineProvenance(ctx contractapi.TransactionContextInterface, id string) (*Provenance, error) {
+        history, err := s.GetMedicineHistory(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        sort.SliceStable(history, func(i, j int) bool {
+                return history[i].Timestamp.Before(history[j].Timestamp)
+        })
+
+        provenance := &Provenance{MedicineID: id, Hops: []*CustodyHop{}, Consistent: true}
+        var previous *Medicine
+        for _, entry := range history {
+                if entry.IsDelete || entry.Record == nil {
+                        provenance.add(&CustodyHop{
+                                TxID:      entry.TxId,
+                                Timestamp: entry.Timestamp,
+                                Flags:     []ProvenanceFlag{ProvenanceDeleted},
+                        })
+                        previous = nil
+                        continue
+                }
+
+                record := entry.Record
+                if previous != nil && record.ReceiverID == previous.ReceiverID {
+                        previous = record
+                        continue
+                }
+
+                hop := &CustodyHop{
+                        Holder:         record.ReceiverID,
+                        From:           record.SenderID,
+                        State:          record.State,
+                        TxID:           entry.TxId,
+                        Timestamp:      entry.Timestamp,
+                        SubmitterMSPID: record.SubmitterMSPID,
+                        Submitter:      record.Submitter,
+                        Flags:          []ProvenanceFlag{},
+                }
+                if record.State == StateReturned {
+                        hop.ReturnReason = record.ReturnReason
+                }
+
+                if previous != nil {
+                        if record.SenderID != previous.ReceiverID {
+                                hop.Flags = append(hop.Flags, ProvenanceCustodyGap)
+                        }
+                        if previous.State != StateInTransit && previous.State != StateReturning {
+                                hop.Flags = append(hop.Flags, ProvenanceUntrackedHandover)
+                        }
+
+                        participant, err := getParticipant(ctx, record.ReceiverID)
+                        if err != nil {
+                                return nil, err
+                        }
+                        if participant != nil && record.SubmitterMSPID != "" && record.SubmitterMSPID != participant.MSPID {
+                                hop.Flags = append(hop.Flags, ProvenanceSubmitterMismatch)
+                        }
+                }
+                if record.SubmitterMSPID == "" {
+                        hop.Flags = append(hop.Flags, ProvenanceUnattributed)
+                }
+
+                provenance.add(hop)
+                previous = record
+        }
+
+        return provenance, nil
+}
+
+// add appends a hop and clears Consistent if the hop is flagged as inconsistent.
+func (p *Provenance) add(hop *CustodyHop) {
+        p.Hops = append(p.Hops, hop)
+        for _, flag := range hop.Flags {
+                if flag != ProvenanceUnattributed {
+                        p.Consistent = false
+                }
+        }
+}
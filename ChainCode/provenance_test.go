@@ -0,0 +1,105 @@
+package main
+
+import "testing"
+
+// expectHops fails the test unless the provenance has one hop per holder, in order.
+func expectHops(t *testing.T, provenance *Provenance, holders ...string) {
+        if len(provenance.Hops) != len(holders) {
+                t.Fatalf("expected %d hops, got %d", len(holders), len(provenance.Hops))
+        }
+        for i, holder := range holders {
+                if provenance.Hops[i].Holder != holder {
+                        t.Fatalf("expected hop %d to be held by %s, got %s", i, holder, provenance.Hops[i].Holder)
+                }
+        }
+}
+
+func TestProvenanceOfTwoPhaseHandover(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.deliverToPharmacy("M1", "PHARM1")
+
+        provenance, err := ledger.contract.GetMedicineProvenance(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to get the provenance of M1: %v", err)
+        }
+        expectHops(t, provenance, "MFG1", "PHARM1")
+        if !provenance.Consistent {
+                t.Fatalf("expected a two-phase handover to be consistent, got %+v", provenance.Hops[1])
+        }
+
+        hop := provenance.Hops[1]
+        if hop.From != "MFG1" || hop.State != StateAtPharmacy || hop.SubmitterMSPID != "Org1MSP" || hop.Submitter == "" {
+                t.Fatalf("unexpected hop %+v", hop)
+        }
+        if len(hop.Flags) != 0 {
+                t.Fatalf("expected the handover not to be flagged, got %v", hop.Flags)
+        }
+}
+
+func TestProvenanceOfReturn(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.deliverToPharmacy("M1", "PHARM1")
+
+        _, err := ledger.contract.ReturnMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "MFG1",
+                string(ReturnOverstock), "")
+        if err != nil {
+                t.Fatalf("failed to return M1: %v", err)
+        }
+        _, err = ledger.contract.AcknowledgeReturn(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to acknowledge the return of M1: %v", err)
+        }
+
+        provenance, err := ledger.contract.GetMedicineProvenance(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to get the provenance of M1: %v", err)
+        }
+        expectHops(t, provenance, "MFG1", "PHARM1", "MFG1")
+        if !provenance.Consistent {
+                t.Fatalf("expected a return to be consistent, got %+v", provenance.Hops[2])
+        }
+
+        hop := provenance.Hops[2]
+        if hop.From != "PHARM1" || hop.State != StateReturned || hop.ReturnReason != ReturnOverstock {
+                t.Fatalf("unexpected return hop %+v", hop)
+        }
+}
+
+func TestProvenanceFlagsInconsistentHop(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.releaseMedicine("M1")
+
+        // Write a change of holder directly, as a client of another organisation,
+        // without a pending transfer and with a sender that never held M1.
+        ctx := ledger.as("Org3MSP", RoleDistributor, "DIST1")
+        medicine, err := ledger.contract.ReadMedicine(ctx, "M1")
+        if err != nil {
+                t.Fatalf("failed to read M1: %v", err)
+        }
+        medicine.SenderID = "PHARM2"
+        medicine.ReceiverID = "DIST1"
+        medicine.State = StateAtDistributor
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                t.Fatalf("failed to write M1: %v", err)
+        }
+
+        provenance, err := ledger.contract.GetMedicineProvenance(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to get the provenance of M1: %v", err)
+        }
+        expectHops(t, provenance, "MFG1", "DIST1")
+        if provenance.Consistent {
+                t.Fatalf("expected the direct change of holder to make the provenance inconsistent")
+        }
+
+        flags := map[ProvenanceFlag]bool{}
+        for _, flag := range provenance.Hops[1].Flags {
+                flags[flag] = true
+        }
+        for _, flag := range []ProvenanceFlag{ProvenanceCustodyGap, ProvenanceUntrackedHandover, ProvenanceSubmitterMismatch} {
+                if !flags[flag] {
+                        t.Errorf("expected the hop to be flagged %s, got %v", flag, provenance.Hops[1].Flags)
+                }
+        }
+}
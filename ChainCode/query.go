@@ -0,0 +1,256 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "strings"
+
+        "github.com/hyperledger/fabric-chaincode-go/shim"
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PaginatedQueryResult is one page of medicines together with the bookmark
+// to pass back in order to fetch the next page. FetchedRecordsCount is the
+// number of medicines in Records; documents the peer fetched that are not
+// medicines, such as those under composite keys, are not counted, so a page
+// can hold fewer records than the page size without being the last one.
+type PaginatedQueryResult struct {
+        Records             []*Medicine `json:"Records"`
+        FetchedRecordsCount int32       `json:"FetchedRecordsCount"`
+        Bookmark            string      `json:"Bookmark"`
+}
+
+// GetAllMedicinesWithPagination returns one page of the medicines found in the
+// world state. Pass an empty bookmark to start from the first medicine.
+func (s *SmartContract) GetAllMedicinesWithPagination(ctx contractapi.TransactionContextInterface,
+        pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        if pageSize <= 0 {
+                return nil, fmt.Errorf("page size must be greater than zero, got %d", pageSize)
+        }
+
+        resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get medicines from world state: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        medicines, err := constructMedicinesFromIterator(ctx, resultsIterator)
+        if err != nil {
+                return nil, err
+        }
+
+        return &PaginatedQueryResult{
+                Records:             medicines,
+                FetchedRecordsCount: int32(len(medicines)),
+                Bookmark:            responseMetadata.Bookmark,
+        }, nil
+}
+
+// sortIndexes maps each field that can be used for sorting to the CouchDB
+// index shipped under META-INF/statedb/couchdb/indexes. CouchDB can only sort
+// on indexed fields.
+var sortIndexes = map[string][2]string{
+        "Manufacturer": {"indexManufacturerDoc", "indexManufacturer"},
+        "Batch_No":     {"indexBatchNoDoc", "indexBatchNo"},
+        "ReceiverId":   {"indexReceiverIdDoc", "indexReceiverId"},
+        "ExpiryDate":   {"indexExpiryDateDoc", "indexExpiryDate"},
+        "DrapNo":       {"indexDrapNoDoc", "indexDrapNo"},
+}
+
+// QueryMedicines returns the medicines matching the given CouchDB Mango
+// selector, e.g. {"Manufacturer":"ABC Pharmaceuticals"}. Rich queries are
+// only supported on peers using CouchDB as the state database. Units with a
+// GTIN do not store Name, BrandName, Composition or DosageForm, so selectors
+// on those fields only match units without one; look the product up in the
+// catalog and select its units by GTIN instead.
+func (s *SmartContract) QueryMedicines(ctx contractapi.TransactionContextInterface, selector string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        queryString, err := buildQueryString(selector, "", "")
+        if err != nil {
+                return nil, err
+        }
+
+        return getQueryResultForQueryString(ctx, queryString)
+}
+
+// QueryMedicinesWithPagination returns one page of the medicines matching the
+// given CouchDB Mango selector. Pass an empty bookmark to fetch the first page.
+func (s *SmartContract) QueryMedicinesWithPagination(ctx contractapi.TransactionContextInterface,
+        selector string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        queryString, err := buildQueryString(selector, "", "")
+        if err != nil {
+                return nil, err
+        }
+
+        return getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// QueryMedicinesSorted returns the medicines matching the given CouchDB Mango
+// selector ordered by sortField, which must be one of the indexed fields.
+// sortOrder is either "asc" or "desc".
+func (s *SmartContract) QueryMedicinesSorted(ctx contractapi.TransactionContextInterface,
+        selector string, sortField string, sortOrder string) ([]*Medicine, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        queryString, err := buildQueryString(selector, sortField, sortOrder)
+        if err != nil {
+                return nil, err
+        }
+
+        return getQueryResultForQueryString(ctx, queryString)
+}
+
+// QueryMedicinesSortedWithPagination returns one page of the medicines
+// matching the given CouchDB Mango selector ordered by sortField.
+func (s *SmartContract) QueryMedicinesSortedWithPagination(ctx contractapi.TransactionContextInterface,
+        selector string, sortField string, sortOrder string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        queryString, err := buildQueryString(selector, sortField, sortOrder)
+        if err != nil {
+                return nil, err
+        }
+
+        return getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// buildQueryString wraps a Mango selector into a CouchDB query, adding the
+// sort clause and index hint when a sort field is given.
+func buildQueryString(selector string, sortField string, sortOrder string) (string, error) {
+        var parsed map[string]interface{}
+        err := json.Unmarshal([]byte(selector), &parsed)
+        if err != nil || parsed == nil {
+                return "", fmt.Errorf("selector must be a JSON object: %s", selector)
+        }
+
+        query := map[string]interface{}{
+                "selector": parsed,
+        }
+
+        if sortField != "" {
+                index, ok := sortIndexes[sortField]
+                if !ok {
+                        return "", fmt.Errorf("cannot sort on %s, it is not an indexed field", sortField)
+                }
+
+                sortOrder = strings.ToLower(sortOrder)
+                if sortOrder == "" {
+                        sortOrder = "asc"
+                }
+                if sortOrder != "asc" && sortOrder != "desc" {
+                        return "", fmt.Errorf("sort order must be asc or desc, got %s", sortOrder)
+                }
+
+                // CouchDB only sorts on an index when the sort field is part of the selector
+                query["selector"] = map[string]interface{}{
+                        "$and": []interface{}{
+                                parsed,
+                                map[string]interface{}{sortField: map[string]interface{}{"$gt": nil}},
+                        },
+                }
+                query["sort"] = []map[string]string{{sortField: sortOrder}}
+                query["use_index"] = []string{"_design/" + index[0], index[1]}
+        }
+
+        queryJSON, err := json.Marshal(query)
+        if err != nil {
+                return "", fmt.Errorf("failed to marshal query JSON: %v", err)
+        }
+
+        return string(queryJSON), nil
+}
+
+// getQueryResultForQueryString executes a CouchDB query and decodes the
+// matching medicines.
+func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Medicine, error) {
+        resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+        if err != nil {
+                return nil, fmt.Errorf("failed to query medicines: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        return constructMedicinesFromIterator(ctx, resultsIterator)
+}
+
+// getQueryResultForQueryStringWithPagination executes a CouchDB query and
+// decodes one page of the matching medicines.
+func getQueryResultForQueryStringWithPagination(ctx contractapi.TransactionContextInterface,
+        queryString string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+        if pageSize <= 0 {
+                return nil, fmt.Errorf("page size must be greater than zero, got %d", pageSize)
+        }
+
+        resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+        if err != nil {
+                return nil, fmt.Errorf("failed to query medicines: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        medicines, err := constructMedicinesFromIterator(ctx, resultsIterator)
+        if err != nil {
+                return nil, err
+        }
+
+        return &PaginatedQueryResult{
+                Records:             medicines,
+                FetchedRecordsCount: int32(len(medicines)),
+                Bookmark:            responseMetadata.Bookmark,
+        }, nil
+}
+
+// isCompositeKey reports whether a world state key was built with
+// CreateCompositeKey. Such keys hold indexes and other asset types, never
+// medicines, and are skipped when decoding query results.
+func isCompositeKey(key string) bool {
+        return strings.HasPrefix(key, "\x00")
+}
+
+// constructMedicinesFromIterator decodes every medicine returned by a state
+// query iterator, merged with their catalog products. CouchDB queries also
+// match the products, registrations and other records stored under composite
+// keys, which are skipped.
+func constructMedicinesFromIterator(ctx contractapi.TransactionContextInterface,
+        resultsIterator shim.StateQueryIteratorInterface) ([]*Medicine, error) {
+        var medicines []*Medicine
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over medicines: %v", err)
+                }
+                if isCompositeKey(queryResponse.Key) {
+                        continue
+                }
+
+                medicine, err := unmarshalMedicine(queryResponse.Value)
+                if err != nil {
+                        return nil, err
+                }
+                err = applyProduct(ctx, medicine)
+                if err != nil {
+                        return nil, err
+                }
+                medicines = append(medicines, medicine)
+        }
+
+        return medicines, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestQueryMedicinesSkipsCompositeKeyDocuments(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        _, err := ledger.contract.AddProduct(ledger.as("Org1MSP", RoleManufacturer, "MFG1"), "8960000000016",
+                "Panadol", "Panadol", "Paracetamol", "Tablet", "GSK", "DRAP-7")
+        if err != nil {
+                t.Fatalf("failed to add product: %v", err)
+        }
+        ledger.createMedicine(medicineInput("M1"))
+
+        medicines, err := ledger.contract.QueryMedicines(ledger.manufacturer(), `{"DrapNo":"DRAP-7"}`)
+        if err != nil {
+                t.Fatalf("QueryMedicines failed: %v", err)
+        }
+        if len(medicines) != 1 || medicines[0].ID != "M1" {
+                ids := []string{}
+                for _, medicine := range medicines {
+                        ids = append(ids, medicine.ID)
+                }
+                t.Fatalf("expected only medicine M1, got %v", ids)
+        }
+}
+
+func TestListedMedicinesIncludeCatalogAttributes(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        _, err := ledger.contract.AddProduct(ledger.manufacturer(), "8960000000016",
+                "Panadol", "Panadol Extra", "Paracetamol", "Tablet", "GSK", "DRAP-7")
+        if err != nil {
+                t.Fatalf("failed to add product: %v", err)
+        }
+        input := medicineInput("M1")
+        input.GTIN = "8960000000016"
+        input.BrandName = ""
+        ledger.createMedicine(input)
+
+        all, err := ledger.contract.GetAllMedicines(ledger.manufacturer())
+        if err != nil {
+                t.Fatalf("GetAllMedicines failed: %v", err)
+        }
+        queried, err := ledger.contract.QueryMedicines(ledger.manufacturer(), `{"GTIN":"8960000000016"}`)
+        if err != nil {
+                t.Fatalf("QueryMedicines failed: %v", err)
+        }
+        history, err := ledger.contract.GetMedicineHistory(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("GetMedicineHistory failed: %v", err)
+        }
+        if len(history) != 1 || history[0].Record.BrandName != "Panadol Extra" {
+                t.Fatalf("expected the history of M1 to merge its product, got %+v", history)
+        }
+        for name, medicines := range map[string][]*Medicine{"GetAllMedicines": all, "QueryMedicines": queried} {
+                if len(medicines) != 1 {
+                        t.Fatalf("expected %s to return M1 only, got %d medicines", name, len(medicines))
+                }
+                if medicines[0].Name != "Panadol" || medicines[0].BrandName != "Panadol Extra" {
+                        t.Fatalf("expected %s to merge M1 with its product, got %+v", name, medicines[0])
+                }
+        }
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "strings"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RecallSeverity is the DRAP recall classification, Class I being the most serious.
+type RecallSeverity string
+
+// Recall severities.
+const (
+        RecallClassI   RecallSeverity = "ClassI"
+        RecallClassII  RecallSeverity = "ClassII"
+        RecallClassIII RecallSeverity = "ClassIII"
+)
+
+// RecallStatus is the state of a batch recall.
+type RecallStatus string
+
+// Recall statuses. Closing a recall does not return recalled units to the
+// supply chain; it only lifts the block on the batch number.
+const (
+        RecallActive RecallStatus = "Active"
+        RecallClosed RecallStatus = "Closed"
+)
+
+// recallObjectType keys recalls by manufacturer and batch number, since
+// batch numbers are only unique within a manufacturer.
+const recallObjectType = "recall"
+
+// Recall is a regulator-issued recall of every unit in a manufacturer's batch.
+type Recall struct {
+        Manufacturer  string         `json:"Manufacturer"`
+        BatchNo       string         `json:"Batch_No"`
+        Reason        string         `json:"Reason"`
+        Severity      RecallSeverity `json:"Severity"`
+        Status        RecallStatus   `json:"Status"`
+        RecalledUnits []string       `json:"RecalledUnits"`
+        RecalledAt    time.Time      `json:"RecalledAt"`
+        RecalledBy    string         `json:"RecalledBy"`
+        TxID          string         `json:"TxId"`
+        ClosedAt      time.Time      `json:"ClosedAt"`
+}
+
+// RecallBatch recalls every medicine in the given batch of the given
+// manufacturer. Units that can still move in the supply chain are moved to the
+// Recalled state, which blocks further transfers and dispensing, and new units
+// cannot be created in the batch while the recall is active. Batches of other
+// manufacturers that share the batch number are not affected.
+func (s *SmartContract) RecallBatch(ctx contractapi.TransactionContextInterface,
+        manufacturer string, batchNo string, reason string, severity string) (*Recall, error) {
+        err := authorize(ctx, ActionRecall)
+        if err != nil {
+                return nil, err
+        }
+
+        if manufacturer == "" || batchNo == "" {
+                return nil, fmt.Errorf("a manufacturer and a batch number are required to issue a recall")
+        }
+        if reason == "" {
+                return nil, fmt.Errorf("a reason is required to recall batch %s", batchNo)
+        }
+        recallSeverity := RecallSeverity(severity)
+        if recallSeverity != RecallClassI && recallSeverity != RecallClassII && recallSeverity != RecallClassIII {
+                return nil, fmt.Errorf("invalid recall severity %q, expected %s, %s or %s",
+                        severity, RecallClassI, RecallClassII, RecallClassIII)
+        }
+
+        existing, err := getRecall(ctx, manufacturer, batchNo)
+        if err != nil {
+                return nil, err
+        }
+        if existing != nil && existing.Status == RecallActive {
+                return nil, fmt.Errorf("the batch %s of %s is already under an active recall", batchNo, manufacturer)
+        }
+
+        mspID, _, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        medicines, err := s.getMedicinesByIndex(ctx, batchIndex, batchNo)
+        if err != nil {
+                return nil, err
+        }
+
+        recall := &Recall{
+                Manufacturer:  manufacturer,
+                BatchNo:       batchNo,
+                Reason:        reason,
+                Severity:      recallSeverity,
+                Status:        RecallActive,
+                RecalledUnits: []string{},
+                RecalledAt:    now,
+                RecalledBy:    mspID,
+                TxID:          ctx.GetStub().GetTxID(),
+        }
+
+        for _, medicine := range medicines {
+                if !sameText(medicine.Manufacturer, manufacturer) || !canTransition(medicine.State, StateRecalled) {
+                        continue
+                }
+
+                err = medicine.transitionTo(StateRecalled)
+                if err != nil {
+                        return nil, err
+                }
+                medicine.TimeStamp = now
+
+                err = putMedicine(ctx, medicine)
+                if err != nil {
+                        return nil, err
+                }
+                recall.RecalledUnits = append(recall.RecalledUnits, medicine.ID)
+        }
+
+        err = putRecall(ctx, recall)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventBatchRecalled, BatchNo: batchNo, Recall: recall})
+        if err != nil {
+                return nil, err
+        }
+
+        return recall, nil
+}
+
+// CloseRecall closes the active recall of a manufacturer's batch once it has
+// been dealt with.
+func (s *SmartContract) CloseRecall(ctx contractapi.TransactionContextInterface,
+        manufacturer string, batchNo string) (*Recall, error) {
+        err := authorize(ctx, ActionRecall)
+        if err != nil {
+                return nil, err
+        }
+
+        recall, err := getRecall(ctx, manufacturer, batchNo)
+        if err != nil {
+                return nil, err
+        }
+        if recall == nil || recall.Status != RecallActive {
+                return nil, fmt.Errorf("the batch %s of %s has no active recall", batchNo, manufacturer)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        recall.Status = RecallClosed
+        recall.ClosedAt = now
+
+        err = putRecall(ctx, recall)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventRecallClosed, BatchNo: batchNo, Recall: recall})
+        if err != nil {
+                return nil, err
+        }
+
+        return recall, nil
+}
+
+// GetRecallStatus returns the latest recall of a manufacturer's batch, or an
+// error if the batch has never been recalled.
+func (s *SmartContract) GetRecallStatus(ctx contractapi.TransactionContextInterface,
+        manufacturer string, batchNo string) (*Recall, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        recall, err := getRecall(ctx, manufacturer, batchNo)
+        if err != nil {
+                return nil, err
+        }
+        if recall == nil {
+                return nil, fmt.Errorf("the batch %s of %s has never been recalled", batchNo, manufacturer)
+        }
+
+        return recall, nil
+}
+
+// GetActiveRecalls returns every recall that has not been closed.
+func (s *SmartContract) GetActiveRecalls(ctx contractapi.TransactionContextInterface) ([]*Recall, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(recallObjectType, []string{})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get recalls from world state: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var recalls []*Recall
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over recalls: %v", err)
+                }
+
+                var recall Recall
+                err = json.Unmarshal(queryResponse.Value, &recall)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal recall JSON: %v", err)
+                }
+                if recall.Status == RecallActive {
+                        recalls = append(recalls, &recall)
+                }
+        }
+
+        return recalls, nil
+}
+
+// applyRecallStatus marks a medicine as Recalled when its batch is under an
+// active recall that has not reached it yet, e.g. a unit written before batch
+// indexes were maintained. The change is only persisted if the caller writes
+// the medicine back.
+func applyRecallStatus(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        if medicine.Batch_No == "" || !canTransition(medicine.State, StateRecalled) {
+                return nil
+        }
+
+        recall, err := getRecall(ctx, medicine.Manufacturer, medicine.Batch_No)
+        if err != nil {
+                return err
+        }
+        if recall != nil && recall.Status == RecallActive {
+                medicine.setState(StateRecalled)
+        }
+
+        return nil
+}
+
+// checkBatchNotRecalled returns an error if the manufacturer's batch is under
+// an active recall.
+func checkBatchNotRecalled(ctx contractapi.TransactionContextInterface, manufacturer string, batchNo string) error {
+        recall, err := getRecall(ctx, manufacturer, batchNo)
+        if err != nil {
+                return err
+        }
+        if recall != nil && recall.Status == RecallActive {
+                return fmt.Errorf("the batch %s of %s is under an active %s recall", batchNo, manufacturer, recall.Severity)
+        }
+
+        return nil
+}
+
+// getRecall returns the latest recall of a manufacturer's batch, or nil if it has none.
+func getRecall(ctx contractapi.TransactionContextInterface, manufacturer string, batchNo string) (*Recall, error) {
+        key, err := recallKey(ctx, manufacturer, batchNo)
+        if err != nil {
+                return nil, err
+        }
+
+        recallJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read recall from world state: %v", err)
+        }
+        if recallJSON == nil {
+                return nil, nil
+        }
+
+        var recall Recall
+        err = json.Unmarshal(recallJSON, &recall)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal recall JSON: %v", err)
+        }
+
+        return &recall, nil
+}
+
+// putRecall writes a recall.
+func putRecall(ctx contractapi.TransactionContextInterface, recall *Recall) error {
+        key, err := recallKey(ctx, recall.Manufacturer, recall.BatchNo)
+        if err != nil {
+                return err
+        }
+
+        recallJSON, err := json.Marshal(recall)
+        if err != nil {
+                return fmt.Errorf("failed to marshal recall JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, recallJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put recall in world state: %v", err)
+        }
+
+        return nil
+}
+
+// recallKey returns the key of the recall of a manufacturer's batch. The
+// manufacturer is compared as sameText does, so that spelling it in another
+// case does not escape a recall.
+func recallKey(ctx contractapi.TransactionContextInterface, manufacturer string, batchNo string) (string, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(recallObjectType,
+                []string{strings.ToLower(strings.TrimSpace(manufacturer)), batchNo})
+        if err != nil {
+                return "", fmt.Errorf("failed to create recall key: %v", err)
+        }
+
+        return key, nil
+}
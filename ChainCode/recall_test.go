@@ -0,0 +1,57 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestRecallBatchIsPerManufacturer(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+        getz := medicineInput("M2")
+        getz.Manufacturer = "Getz Pharma"
+        getz.SenderID = "MFG2"
+        getz.ReceiverID = "MFG2"
+        _, err := ledger.contract.CreateMedicineJSON(ledger.as("Org1MSP", RoleManufacturer, "MFG2"), getz)
+        if err != nil {
+                t.Fatalf("failed to create M2: %v", err)
+        }
+
+        recall, err := ledger.contract.RecallBatch(ledger.as("Org2MSP", RoleRegulator, ""), "gsk", "B1", "contamination", string(RecallClassI))
+        if err != nil {
+                t.Fatalf("failed to recall B1 of GSK: %v", err)
+        }
+        if len(recall.RecalledUnits) != 1 || recall.RecalledUnits[0] != "M1" {
+                t.Fatalf("expected only M1 to be recalled, got %v", recall.RecalledUnits)
+        }
+
+        medicine, err := ledger.contract.ReadMedicine(ledger.manufacturer(), "M2")
+        if err != nil {
+                t.Fatalf("failed to read M2: %v", err)
+        }
+        if medicine.State == StateRecalled {
+                t.Fatalf("expected M2 of Getz Pharma not to be recalled")
+        }
+
+        _, err = ledger.contract.CreateMedicineJSON(ledger.manufacturer(), medicineInput("M3"))
+        if err == nil || !strings.Contains(err.Error(), "active") {
+                t.Fatalf("expected a new unit in the recalled batch to be refused, got %v", err)
+        }
+        getz.ID = "M4"
+        _, err = ledger.contract.CreateMedicineJSON(ledger.as("Org1MSP", RoleManufacturer, "MFG2"), getz)
+        if err != nil {
+                t.Fatalf("expected a new unit in the batch of another manufacturer to be created, got %v", err)
+        }
+
+        _, err = ledger.contract.GetRecallStatus(ledger.manufacturer(), "Getz Pharma", "B1")
+        if err == nil {
+                t.Fatalf("expected B1 of Getz Pharma never to have been recalled")
+        }
+        recall, err = ledger.contract.CloseRecall(ledger.as("Org2MSP", RoleRegulator, ""), "GSK", "B1")
+        if err != nil {
+                t.Fatalf("failed to close the recall of B1 of GSK: %v", err)
+        }
+        if recall.Status != RecallClosed {
+                t.Fatalf("expected the recall to be %s, got %s", RecallClosed, recall.Status)
+        }
+}
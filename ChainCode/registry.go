@@ -0,0 +1,288 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "strings"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// registrationObjectType keys DRAP product registrations by registration number.
+const registrationObjectType = "registration"
+
+// DRAPRegistration is a product registered with the Drug Regulatory Authority
+// of Pakistan. Units may only be created under a registration that is valid
+// at the time of the transaction.
+type DRAPRegistration struct {
+        DRAPNo             string    `json:"DrapNo"`
+        ApprovedName       string    `json:"ApprovedName"`
+        Composition        string    `json:"Composition"`
+        DosageForm         string    `json:"DosageForm"`
+        Strength           string    `json:"Strength"`
+        RegistrationHolder string    `json:"RegistrationHolder"`
+        ValidFrom          time.Time `json:"ValidFrom"`
+        ValidUntil         time.Time `json:"ValidUntil"`
+        UpdatedAt          time.Time `json:"UpdatedAt"`
+        UpdatedBy          string    `json:"UpdatedBy"`
+        TxID               string    `json:"TxId"`
+}
+
+// RegisterDRAPProduct adds a product to the DRAP registry, or amends or renews
+// an existing registration. Dates are YYYY-MM-DD and the registration is valid
+// through validUntil.
+func (s *SmartContract) RegisterDRAPProduct(ctx contractapi.TransactionContextInterface,
+        drapNo string, approvedName string, composition string, dosageForm string, strength string,
+        registrationHolder string, validFrom string, validUntil string) (*DRAPRegistration, error) {
+        err := authorize(ctx, ActionRegister)
+        if err != nil {
+                return nil, err
+        }
+
+        if drapNo == "" {
+                return nil, fmt.Errorf("a DRAP registration number is required")
+        }
+        if approvedName == "" || composition == "" || dosageForm == "" {
+                return nil, fmt.Errorf("the approved name, composition and dosage form of DRAP registration %s are required", drapNo)
+        }
+
+        from, err := parseDate(validFrom)
+        if err != nil {
+                return nil, fmt.Errorf("invalid ValidFrom: %v", err)
+        }
+        until, err := parseDate(validUntil)
+        if err != nil {
+                return nil, fmt.Errorf("invalid ValidUntil: %v", err)
+        }
+        if until.Before(from) {
+                return nil, fmt.Errorf("ValidUntil %s must not be before ValidFrom %s",
+                        until.Format(dateLayout), from.Format(dateLayout))
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        mspID, _, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        registration := &DRAPRegistration{
+                DRAPNo:             drapNo,
+                ApprovedName:       approvedName,
+                Composition:        composition,
+                DosageForm:         dosageForm,
+                Strength:           strength,
+                RegistrationHolder: registrationHolder,
+                ValidFrom:          from,
+                ValidUntil:         until,
+                UpdatedAt:          now,
+                UpdatedBy:          mspID,
+                TxID:               ctx.GetStub().GetTxID(),
+        }
+
+        err = putRegistration(ctx, registration)
+        if err != nil {
+                return nil, err
+        }
+
+        return registration, nil
+}
+
+// InitRegistry registers the DRAP products of the sample medicines issued by
+// InitLedger and the manufacturers and distributors they move between.
+// Registrations and participants that already exist are left as they are, so
+// it never undoes an amendment, a renewal or a suspension.
+func (s *SmartContract) InitRegistry(ctx contractapi.TransactionContextInterface) error {
+        err := authorize(ctx, ActionRegister)
+        if err != nil {
+                return err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+
+        strengths := map[string]string{"1": "300mg", "2": "500mg", "3": "200mg", "4": "250mg", "5": "20mg"}
+        for _, medicine := range sampleMedicines(now) {
+                existing, err := getRegistration(ctx, medicine.DRAPNo)
+                if err != nil {
+                        return err
+                }
+                if existing != nil {
+                        continue
+                }
+
+                _, err = s.RegisterDRAPProduct(ctx, medicine.DRAPNo, medicine.Name, medicine.Composition,
+                        medicine.DosageForm, strengths[medicine.DRAPNo], medicine.Manufacturer, "2021-01-01", "2030-12-31")
+                if err != nil {
+                        return err
+                }
+        }
+
+        for _, medicine := range sampleMedicines(now) {
+                for _, participant := range []Participant{
+                        {ID: medicine.SenderID, Name: medicine.Manufacturer, Type: ParticipantManufacturer},
+                        {ID: medicine.ReceiverID, Name: medicine.ReceiverID, Type: ParticipantDistributor},
+                } {
+                        existing, err := getParticipant(ctx, participant.ID)
+                        if err != nil {
+                                return err
+                        }
+                        if existing != nil {
+                                continue
+                        }
+
+                        _, err = s.RegisterParticipant(ctx, participant.ID, participant.Name, string(participant.Type),
+                                "LIC-"+participant.ID, "2030-12-31", "Org1MSP", "")
+                        if err != nil {
+                                return err
+                        }
+                }
+        }
+
+        return nil
+}
+
+// ReadDRAPRegistration returns the registry entry for a DRAP registration number.
+func (s *SmartContract) ReadDRAPRegistration(ctx contractapi.TransactionContextInterface, drapNo string) (*DRAPRegistration, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        registration, err := getRegistration(ctx, drapNo)
+        if err != nil {
+                return nil, err
+        }
+        if registration == nil {
+                return nil, fmt.Errorf("the DRAP registration %s is not in the product registry", drapNo)
+        }
+
+        return registration, nil
+}
+
+// GetDRAPRegistrations returns every entry in the DRAP product registry.
+func (s *SmartContract) GetDRAPRegistrations(ctx contractapi.TransactionContextInterface) ([]*DRAPRegistration, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(registrationObjectType, []string{})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get registrations from world state: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var registrations []*DRAPRegistration
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over registrations: %v", err)
+                }
+
+                var registration DRAPRegistration
+                err = json.Unmarshal(queryResponse.Value, &registration)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal registration JSON: %v", err)
+                }
+                registrations = append(registrations, &registration)
+        }
+
+        return registrations, nil
+}
+
+// checkRegistration returns an error unless the medicine's DRAP number is in
+// the registry, valid at the time of the transaction and consistent with the
+// medicine's name, composition and dosage form.
+func checkRegistration(ctx contractapi.TransactionContextInterface, medicine *Medicine) error {
+        registration, err := getRegistration(ctx, medicine.DRAPNo)
+        if err != nil {
+                return err
+        }
+        if registration == nil {
+                return fmt.Errorf("the DRAP registration %s is not in the product registry", medicine.DRAPNo)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        if now.Before(registration.ValidFrom) {
+                return fmt.Errorf("the DRAP registration %s is not valid until %s",
+                        medicine.DRAPNo, registration.ValidFrom.Format(dateLayout))
+        }
+        if !now.Before(registration.ValidUntil.AddDate(0, 0, 1)) {
+                return fmt.Errorf("the DRAP registration %s expired on %s",
+                        medicine.DRAPNo, registration.ValidUntil.Format(dateLayout))
+        }
+
+        mismatch := func(field string, value string, approved string) error {
+                return fmt.Errorf("the %s %q does not match %q approved under DRAP registration %s",
+                        field, value, approved, medicine.DRAPNo)
+        }
+        if !sameText(medicine.Name, registration.ApprovedName) {
+                return mismatch("Name", medicine.Name, registration.ApprovedName)
+        }
+        if !sameText(medicine.Composition, registration.Composition) {
+                return mismatch("Composition", medicine.Composition, registration.Composition)
+        }
+        if !sameText(medicine.DosageForm, registration.DosageForm) {
+                return mismatch("DosageForm", medicine.DosageForm, registration.DosageForm)
+        }
+
+        return nil
+}
+
+// sameText compares registry values ignoring case and surrounding space.
+func sameText(a string, b string) bool {
+        return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// getRegistration returns the registry entry for a DRAP number, or nil if it has none.
+func getRegistration(ctx contractapi.TransactionContextInterface, drapNo string) (*DRAPRegistration, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(registrationObjectType, []string{drapNo})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create registration key: %v", err)
+        }
+
+        registrationJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read registration from world state: %v", err)
+        }
+        if registrationJSON == nil {
+                return nil, nil
+        }
+
+        var registration DRAPRegistration
+        err = json.Unmarshal(registrationJSON, &registration)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal registration JSON: %v", err)
+        }
+
+        return &registration, nil
+}
+
+// putRegistration writes a registry entry.
+func putRegistration(ctx contractapi.TransactionContextInterface, registration *DRAPRegistration) error {
+        key, err := ctx.GetStub().CreateCompositeKey(registrationObjectType, []string{registration.DRAPNo})
+        if err != nil {
+                return fmt.Errorf("failed to create registration key: %v", err)
+        }
+
+        registrationJSON, err := json.Marshal(registration)
+        if err != nil {
+                return fmt.Errorf("failed to marshal registration JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, registrationJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put registration in world state: %v", err)
+        }
+
+        return nil
+}
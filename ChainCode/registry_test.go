@@ -0,0 +1,63 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestCreateMedicineRequiresRegistration(t *testing.T) {
+        ledger := newTestLedger(t)
+
+        unregistered := medicineInput("M1")
+        unregistered.DRAPNo = "DRAP-8"
+        _, err := ledger.contract.CreateMedicineJSON(ledger.manufacturer(), unregistered)
+        if err == nil || !strings.Contains(err.Error(), "not in the product registry") {
+                t.Fatalf("expected a unit of an unregistered product to be refused, got %v", err)
+        }
+
+        mismatched := medicineInput("M1")
+        mismatched.Composition = "Ibuprofen"
+        _, err = ledger.contract.CreateMedicineJSON(ledger.manufacturer(), mismatched)
+        if err == nil || !strings.Contains(err.Error(), "does not match") {
+                t.Fatalf("expected a unit that does not match its registration to be refused, got %v", err)
+        }
+
+        ledger.createMedicine(medicineInput("M1"))
+}
+
+func TestUpdateMedicineRequiresRegistration(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+
+        input := medicineInput("M1")
+        input.Name = "Brufen"
+        _, err := ledger.contract.UpdateMedicineJSON(ledger.manufacturer(), input)
+        if err == nil || !strings.Contains(err.Error(), "does not match") {
+                t.Fatalf("expected an update away from the registered name to be refused, got %v", err)
+        }
+
+        input = medicineInput("M1")
+        input.BrandName = "Panadol Extra"
+        medicine, err := ledger.contract.UpdateMedicineJSON(ledger.manufacturer(), input)
+        if err != nil {
+                t.Fatalf("failed to update M1: %v", err)
+        }
+        if medicine.BrandName != "Panadol Extra" {
+                t.Fatalf("expected the brand name to be updated, got %s", medicine.BrandName)
+        }
+}
+
+func TestPatchMedicineRequiresRegistration(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.createMedicine(medicineInput("M1"))
+
+        _, err := ledger.contract.PatchMedicine(ledger.manufacturer(), "M1", `{"DosageForm":"Syrup"}`)
+        if err == nil || !strings.Contains(err.Error(), "does not match") {
+                t.Fatalf("expected a patch away from the registered dosage form to be refused, got %v", err)
+        }
+
+        _, err = ledger.contract.PatchMedicine(ledger.manufacturer(), "M1", `{"BrandName":"Panadol Extra"}`)
+        if err != nil {
+                t.Fatalf("failed to patch M1: %v", err)
+        }
+}
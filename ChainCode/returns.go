@@ -0,0 +1,523 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ReturnReason is why a medicine is sent back to its manufacturer.
+type ReturnReason string
+
+// Return reasons.
+const (
+        ReturnDamaged     ReturnReason = "damaged"
+        ReturnNearExpiry  ReturnReason = "near-expiry"
+        ReturnRecall      ReturnReason = "recall"
+        ReturnOverstock   ReturnReason = "overstock"
+        ReturnMisdelivery ReturnReason = "misdelivery"
+)
+
+// ReturnStatus is the state of a return.
+type ReturnStatus string
+
+// Return statuses. Only a pending return can change status.
+const (
+        ReturnPending      ReturnStatus = "Pending"
+        ReturnAcknowledged ReturnStatus = "Acknowledged"
+        ReturnRejected     ReturnStatus = "Rejected"
+        ReturnCancelled    ReturnStatus = "Cancelled"
+)
+
+// Returns are stored under a composite key per medicine, like transfers. The
+// participant index lists the pending returns each participant is sending or
+// due to acknowledge.
+const (
+        returnObjectType       = "return"
+        returnParticipantIndex = "participant~return"
+)
+
+// Return is a movement of a medicine back up the supply chain to its
+// manufacturer. HolderState is the lifecycle state the medicine goes back to
+// if the return is rejected or cancelled. Resolved returns remain on the
+// ledger until the next return of the same medicine replaces them.
+type Return struct {
+        MedicineID    string         `json:"MedicineId"`
+        From          string         `json:"From"`
+        To            string         `json:"To"`
+        Reason        ReturnReason   `json:"Reason"`
+        Note          string         `json:"Note"`
+        Status        ReturnStatus   `json:"Status"`
+        HolderState   LifecycleState `json:"HolderState"`
+        Resolution    string         `json:"Resolution"`
+        InitiatedAt   time.Time      `json:"InitiatedAt"`
+        ResolvedAt    time.Time      `json:"ResolvedAt"`
+        InitiatedTxID string         `json:"InitiatedTxId"`
+        ResolvedTxID  string         `json:"ResolvedTxId"`
+}
+
+// HolderInventory is the stock a participant holds, with returns kept apart
+// from stock that can still move down the supply chain. OutgoingReturns are
+// still held while they wait for the manufacturer's acknowledgement;
+// ReceivedReturns have been acknowledged by the holder as their manufacturer.
+type HolderInventory struct {
+        Holder          string      `json:"Holder"`
+        Stock           []*Medicine `json:"Stock"`
+        OutgoingReturns []*Medicine `json:"OutgoingReturns"`
+        ReceivedReturns []*Medicine `json:"ReceivedReturns"`
+}
+
+// ReturnMedicine sends a medicine back to manufacturerId for the given reason.
+// Only the current holder, a distributor, pharmacy or hospital, can return,
+// and the receiver must be the registered manufacturer of the medicine. The
+// holder keeps custody until the manufacturer acknowledges the return. Recall
+// returns are only accepted for recalled medicines.
+func (s *SmartContract) ReturnMedicine(ctx contractapi.TransactionContextInterface,
+        id string, manufacturerId string, reason string, note string) (*Return, error) {
+        err := authorize(ctx, ActionReturn)
+        if err != nil {
+                return nil, err
+        }
+
+        returnReason := ReturnReason(reason)
+        switch returnReason {
+        case ReturnDamaged, ReturnNearExpiry, ReturnRecall, ReturnOverstock, ReturnMisdelivery:
+        default:
+                return nil, fmt.Errorf("invalid return reason %q, expected %s, %s, %s, %s or %s", reason,
+                        ReturnDamaged, ReturnNearExpiry, ReturnRecall, ReturnOverstock, ReturnMisdelivery)
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+
+        err = authorizeParticipant(ctx, medicine.ReceiverID)
+        if err != nil {
+                return nil, err
+        }
+        if medicine.ContainerID != "" {
+                return nil, fmt.Errorf("the medicine %s is packed in container %s, unpack it before returning",
+                        id, medicine.ContainerID)
+        }
+
+        existing, err := getReturn(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if existing != nil && existing.Status == ReturnPending {
+                return nil, fmt.Errorf("the medicine %s already has a pending return to %s", id, existing.To)
+        }
+        if returnReason == ReturnRecall && medicine.State != StateRecalled {
+                return nil, fmt.Errorf("the medicine %s is %s, only recalled medicines can be returned for a recall", id, medicine.State)
+        }
+
+        // The holder may be suspended or unlicensed by now and still has to
+        // be able to send stock back, so only its type is checked.
+        holder, err := getParticipant(ctx, medicine.ReceiverID)
+        if err != nil {
+                return nil, err
+        }
+        if holder == nil {
+                return nil, fmt.Errorf("the participant %s is not in the participant registry", medicine.ReceiverID)
+        }
+        if holder.Type == ParticipantManufacturer {
+                return nil, fmt.Errorf("the medicine %s is held by its manufacturer %s", id, holder.ID)
+        }
+
+        err = checkParticipant(ctx, manufacturerId)
+        if err != nil {
+                return nil, err
+        }
+        manufacturer, err := getParticipant(ctx, manufacturerId)
+        if err != nil {
+                return nil, err
+        }
+        if manufacturer.Type != ParticipantManufacturer || !sameText(manufacturer.Name, medicine.Manufacturer) {
+                return nil, fmt.Errorf("the participant %s is not %s, the manufacturer of medicine %s",
+                        manufacturerId, medicine.Manufacturer, id)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        ret := &Return{
+                MedicineID:    id,
+                From:          medicine.ReceiverID,
+                To:            manufacturerId,
+                Reason:        returnReason,
+                Note:          note,
+                Status:        ReturnPending,
+                HolderState:   medicine.State,
+                InitiatedAt:   now,
+                InitiatedTxID: ctx.GetStub().GetTxID(),
+        }
+
+        err = medicine.transitionTo(StateReturning)
+        if err != nil {
+                return nil, err
+        }
+        medicine.ReturnReason = returnReason
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+        err = putReturn(ctx, ret)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventReturnInitiated, Medicine: medicine, Return: ret})
+        if err != nil {
+                return nil, err
+        }
+
+        return ret, nil
+}
+
+// AcknowledgeReturn confirms receipt of a returned medicine. Only the
+// manufacturer the medicine was returned to can acknowledge, after which it
+// holds the medicine in the Returned state.
+func (s *SmartContract) AcknowledgeReturn(ctx contractapi.TransactionContextInterface, id string) (*Medicine, error) {
+        err := authorize(ctx, ActionReturn)
+        if err != nil {
+                return nil, err
+        }
+
+        ret, err := getPendingReturn(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = authorizeParticipant(ctx, ret.To)
+        if err != nil {
+                return nil, err
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+        if medicine.ReceiverID != ret.From {
+                return nil, fmt.Errorf("the medicine %s is no longer held by %s", id, ret.From)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        previous := *medicine
+        err = medicine.transitionTo(StateReturned)
+        if err != nil {
+                return nil, err
+        }
+        medicine.SenderID = ret.From
+        medicine.ReceiverID = ret.To
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+        err = updateMedicineIndexes(ctx, &previous, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = resolveReturn(ctx, ret, ReturnAcknowledged, "")
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventReturnAcknowledged, Medicine: medicine, Return: ret})
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
+}
+
+// RejectReturn refuses the pending return of a medicine. Only the manufacturer
+// it was returned to can reject; the medicine stays with its holder.
+func (s *SmartContract) RejectReturn(ctx contractapi.TransactionContextInterface, id string, reason string) (*Return, error) {
+        err := authorize(ctx, ActionReturn)
+        if err != nil {
+                return nil, err
+        }
+
+        ret, err := getPendingReturn(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = authorizeParticipant(ctx, ret.To)
+        if err != nil {
+                return nil, err
+        }
+
+        err = s.undoReturn(ctx, ret)
+        if err != nil {
+                return nil, err
+        }
+
+        err = resolveReturn(ctx, ret, ReturnRejected, reason)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventReturnRejected, MedicineID: id, Return: ret})
+        if err != nil {
+                return nil, err
+        }
+
+        return ret, nil
+}
+
+// CancelReturn withdraws the pending return of a medicine. Only the holder
+// that started it can cancel.
+func (s *SmartContract) CancelReturn(ctx contractapi.TransactionContextInterface, id string, reason string) (*Return, error) {
+        err := authorize(ctx, ActionReturn)
+        if err != nil {
+                return nil, err
+        }
+
+        ret, err := getPendingReturn(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = authorizeParticipant(ctx, ret.From)
+        if err != nil {
+                return nil, err
+        }
+
+        err = s.undoReturn(ctx, ret)
+        if err != nil {
+                return nil, err
+        }
+
+        err = resolveReturn(ctx, ret, ReturnCancelled, reason)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventReturnCancelled, MedicineID: id, Return: ret})
+        if err != nil {
+                return nil, err
+        }
+
+        return ret, nil
+}
+
+// ReadReturn returns the latest return of a medicine, whatever its status.
+func (s *SmartContract) ReadReturn(ctx contractapi.TransactionContextInterface, id string) (*Return, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        ret, err := getReturn(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if ret == nil {
+                return nil, fmt.Errorf("the medicine %s has never been returned", id)
+        }
+
+        return ret, nil
+}
+
+// GetPendingReturns returns the pending returns the given participant is
+// either sending or due to acknowledge.
+func (s *SmartContract) GetPendingReturns(ctx contractapi.TransactionContextInterface, participantId string) ([]*Return, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(returnParticipantIndex, []string{participantId})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get pending returns: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var returns []*Return
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over pending returns: %v", err)
+                }
+
+                _, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to split pending return key: %v", err)
+                }
+                if len(attributes) != 2 {
+                        return nil, fmt.Errorf("malformed pending return key %q", queryResponse.Key)
+                }
+
+                ret, err := getReturn(ctx, attributes[1])
+                if err != nil {
+                        return nil, err
+                }
+                if ret != nil && ret.Status == ReturnPending {
+                        returns = append(returns, ret)
+                }
+        }
+
+        return returns, nil
+}
+
+// GetHolderInventory returns the medicines held by a participant, with
+// outgoing and received returns listed apart from the rest of its stock.
+func (s *SmartContract) GetHolderInventory(ctx contractapi.TransactionContextInterface, holder string) (*HolderInventory, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        medicines, err := s.getMedicinesByIndex(ctx, holderIndex, holder)
+        if err != nil {
+                return nil, err
+        }
+
+        inventory := &HolderInventory{
+                Holder:          holder,
+                Stock:           []*Medicine{},
+                OutgoingReturns: []*Medicine{},
+                ReceivedReturns: []*Medicine{},
+        }
+        for _, medicine := range medicines {
+                switch medicine.State {
+                case StateReturning:
+                        inventory.OutgoingReturns = append(inventory.OutgoingReturns, medicine)
+                case StateReturned:
+                        inventory.ReceivedReturns = append(inventory.ReceivedReturns, medicine)
+                default:
+                        inventory.Stock = append(inventory.Stock, medicine)
+                }
+        }
+
+        return inventory, nil
+}
+
+// undoReturn puts a medicine whose return did not go ahead back in the state
+// it was in with its holder, or in Recalled if its batch was recalled while
+// the return was pending. A medicine that left Returning meanwhile keeps its
+// state.
+func (s *SmartContract) undoReturn(ctx contractapi.TransactionContextInterface, ret *Return) error {
+        medicine, err := s.ReadMedicine(ctx, ret.MedicineID)
+        if err != nil {
+                return fmt.Errorf("failed to read medicine: %v", err)
+        }
+        if medicine.State != StateReturning {
+                return nil
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        medicine.setState(ret.HolderState)
+        err = applyRecallStatus(ctx, medicine)
+        if err != nil {
+                return err
+        }
+        medicine.ReturnReason = ""
+        medicine.TimeStamp = now
+
+        return putMedicine(ctx, medicine)
+}
+
+// resolveReturn moves a pending return to its final status.
+func resolveReturn(ctx contractapi.TransactionContextInterface, ret *Return, status ReturnStatus, resolution string) error {
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+
+        ret.Status = status
+        ret.Resolution = resolution
+        ret.ResolvedAt = now
+        ret.ResolvedTxID = ctx.GetStub().GetTxID()
+
+        return putReturn(ctx, ret)
+}
+
+// getReturn returns the latest return of a medicine, or nil if it has none.
+func getReturn(ctx contractapi.TransactionContextInterface, medicineID string) (*Return, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(returnObjectType, []string{medicineID})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create return key: %v", err)
+        }
+
+        returnJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read return from world state: %v", err)
+        }
+        if returnJSON == nil {
+                return nil, nil
+        }
+
+        var ret Return
+        err = json.Unmarshal(returnJSON, &ret)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal return JSON: %v", err)
+        }
+
+        return &ret, nil
+}
+
+// getPendingReturn returns the pending return of a medicine.
+func getPendingReturn(ctx contractapi.TransactionContextInterface, medicineID string) (*Return, error) {
+        ret, err := getReturn(ctx, medicineID)
+        if err != nil {
+                return nil, err
+        }
+        if ret == nil || ret.Status != ReturnPending {
+                return nil, fmt.Errorf("the medicine %s has no pending return", medicineID)
+        }
+
+        return ret, nil
+}
+
+// putReturn writes a return and keeps the participant index in step with its
+// status.
+func putReturn(ctx contractapi.TransactionContextInterface, ret *Return) error {
+        key, err := ctx.GetStub().CreateCompositeKey(returnObjectType, []string{ret.MedicineID})
+        if err != nil {
+                return fmt.Errorf("failed to create return key: %v", err)
+        }
+
+        returnJSON, err := json.Marshal(ret)
+        if err != nil {
+                return fmt.Errorf("failed to marshal return JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, returnJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put return in world state: %v", err)
+        }
+
+        for _, participantID := range []string{ret.From, ret.To} {
+                indexKey, err := ctx.GetStub().CreateCompositeKey(returnParticipantIndex, []string{participantID, ret.MedicineID})
+                if err != nil {
+                        return fmt.Errorf("failed to create pending return index key: %v", err)
+                }
+
+                if ret.Status == ReturnPending {
+                        err = ctx.GetStub().PutState(indexKey, indexValue)
+                } else {
+                        err = ctx.GetStub().DelState(indexKey)
+                }
+                if err != nil {
+                        return fmt.Errorf("failed to update pending return index: %v", err)
+                }
+        }
+
+        return nil
+}
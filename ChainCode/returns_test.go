@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestCancelledReturnOfRecalledBatchIsRecalled(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.deliverToPharmacy("M1", "PHARM1")
+
+        _, err := ledger.contract.ReturnMedicine(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "MFG1",
+                string(ReturnOverstock), "")
+        if err != nil {
+                t.Fatalf("failed to return M1: %v", err)
+        }
+        _, err = ledger.contract.RecallBatch(ledger.as("Org2MSP", RoleRegulator, ""), "GSK", "B1", "contamination", string(RecallClassI))
+        if err != nil {
+                t.Fatalf("failed to recall B1: %v", err)
+        }
+        _, err = ledger.contract.CancelReturn(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "sold out elsewhere")
+        if err != nil {
+                t.Fatalf("failed to cancel the return of M1: %v", err)
+        }
+
+        medicine, err := ledger.contract.ReadMedicine(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to read M1: %v", err)
+        }
+        if medicine.State != StateRecalled {
+                t.Fatalf("expected M1 to be %s after its return was cancelled, got %s", StateRecalled, medicine.State)
+        }
+        stored, err := unmarshalMedicine(ledger.stub.State["M1"])
+        if err != nil {
+                t.Fatalf("failed to decode M1: %v", err)
+        }
+        if stored.State != StateRecalled {
+                t.Fatalf("expected M1 to be stored as %s, got %s", StateRecalled, stored.State)
+        }
+}
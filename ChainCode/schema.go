@@ -0,0 +1,159 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "strings"
+        "time"
+)
+
+// medicineSchemaVersion is the record format written by this chaincode.
+// Records without a SchemaVersion field were written by earlier releases,
+// which stored dates and flags as free-form strings. Version 3 added the
+// lifecycle State.
+const medicineSchemaVersion = 3
+
+// dateLayout is the layout accepted for ManufactureDate and ExpiryDate.
+const dateLayout = "2006-01-02"
+
+// timestampLayouts lists the layouts that have been used for TimeStamp,
+// including the one historically sent by the REST server.
+var timestampLayouts = []string{
+        time.RFC3339Nano,
+        time.RFC3339,
+        "2006-01-02 15:04:05 -0700 MST",
+        dateLayout,
+}
+
+// legacyMedicine is the string-only record format used before SchemaVersion 2.
+type legacyMedicine struct {
+        ID               string `json:"ID"`
+        Name             string `json:"Name"`
+        Manufacturer     string `json:"Manufacturer"`
+        ManufactureDate  string `json:"ManufactureDate"`
+        ExpiryDate       string `json:"ExpiryDate"`
+        BrandName        string `json:"BrandName"`
+        Composition      string `json:"Composition"`
+        SenderID         string `json:"SenderId"`
+        ReceiverID       string `json:"ReceiverId"`
+        DRAPNo           string `json:"DrapNo"`
+        DosageForm       string `json:"DosageForm"`
+        TimeStamp        string `json:"TimeStamp"`
+        Batch_No         string `json:"Batch_No"`
+        JourneyCompleted string `json:"JourneyCompleted"`
+}
+
+// upgrade converts a legacy record to the current format. Values that cannot
+// be parsed are left as their zero value rather than failing the read, since
+// the ledger already contains records with arbitrary text in these fields.
+func (l *legacyMedicine) upgrade() *Medicine {
+        manufactureDate, _ := parseTimestamp(l.ManufactureDate)
+        expiryDate, _ := parseTimestamp(l.ExpiryDate)
+        timeStamp, _ := parseTimestamp(l.TimeStamp)
+
+        medicine := &Medicine{
+                SchemaVersion:    medicineSchemaVersion,
+                ID:               l.ID,
+                Name:             l.Name,
+                Manufacturer:     l.Manufacturer,
+                ManufactureDate:  manufactureDate,
+                ExpiryDate:       expiryDate,
+                BrandName:        l.BrandName,
+                Composition:      l.Composition,
+                SenderID:         l.SenderID,
+                ReceiverID:       l.ReceiverID,
+                DRAPNo:           l.DRAPNo,
+                DosageForm:       l.DosageForm,
+                TimeStamp:        timeStamp,
+                Batch_No:         l.Batch_No,
+                JourneyCompleted: parseLegacyBool(l.JourneyCompleted),
+        }
+        upgradeState(medicine)
+
+        return medicine
+}
+
+// upgradeState derives the lifecycle state of a record written before
+// version 3 from its JourneyCompleted flag. Medicines whose journey was not
+// completed are treated as released, since they were already moving.
+func upgradeState(medicine *Medicine) {
+        medicine.SchemaVersion = medicineSchemaVersion
+        if medicine.JourneyCompleted {
+                medicine.setState(StateDispensed)
+        } else {
+                medicine.setState(StateReleased)
+        }
+}
+
+// unmarshalMedicine decodes a medicine record of any schema version and
+// returns it in the current format.
+func unmarshalMedicine(data []byte) (*Medicine, error) {
+        var header struct {
+                SchemaVersion int `json:"SchemaVersion"`
+        }
+        err := json.Unmarshal(data, &header)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal medicine JSON: %v", err)
+        }
+
+        switch {
+        case header.SchemaVersion == medicineSchemaVersion:
+                var medicine Medicine
+                err = json.Unmarshal(data, &medicine)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal medicine JSON: %v", err)
+                }
+                return &medicine, nil
+        case header.SchemaVersion == 2:
+                var medicine Medicine
+                err = json.Unmarshal(data, &medicine)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal medicine JSON: %v", err)
+                }
+                upgradeState(&medicine)
+                return &medicine, nil
+        case header.SchemaVersion < 2:
+                var legacy legacyMedicine
+                err = json.Unmarshal(data, &legacy)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal legacy medicine JSON: %v", err)
+                }
+                return legacy.upgrade(), nil
+        default:
+                return nil, fmt.Errorf("unsupported medicine schema version %d", header.SchemaVersion)
+        }
+}
+
+// parseDate parses a ManufactureDate or ExpiryDate argument.
+func parseDate(value string) (time.Time, error) {
+        date, err := time.Parse(dateLayout, strings.TrimSpace(value))
+        if err != nil {
+                return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+        }
+
+        return date, nil
+}
+
+// parseTimestamp parses a TimeStamp value in any of the known layouts and
+// returns it in UTC.
+func parseTimestamp(value string) (time.Time, error) {
+        value = strings.TrimSpace(value)
+        for _, layout := range timestampLayouts {
+                t, err := time.Parse(layout, value)
+                if err == nil {
+                        return t.UTC(), nil
+                }
+        }
+
+        return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339", value)
+}
+
+// parseLegacyBool interprets the flag values found in legacy records.
+func parseLegacyBool(value string) bool {
+        switch strings.ToLower(strings.TrimSpace(value)) {
+        case "true", "t", "1", "yes", "y":
+                return true
+        default:
+                return false
+        }
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TransferStatus is the state of a custody handover.
+type TransferStatus string
+
+// Transfer statuses. Only a pending transfer can change status.
+const (
+        TransferPending   TransferStatus = "Pending"
+        TransferAccepted  TransferStatus = "Accepted"
+        TransferRejected  TransferStatus = "Rejected"
+        TransferCancelled TransferStatus = "Cancelled"
+)
+
+// Transfers are stored under a composite key per medicine so that they never
+// show up in range queries over medicines. The participant index lists the
+// pending transfers each participant is sending or receiving.
+const (
+        transferObjectType       = "transfer"
+        transferParticipantIndex = "participant~transfer"
+)
+
+// Transfer is a custody handover of a medicine from its current holder to a
+// named recipient. HolderState is the lifecycle state the medicine returns to
+// if the transfer is rejected or cancelled. ContainerID is set when the medicine
+// moves as part of a container. Resolved transfers remain on the ledger until
+// the next handover of the same medicine replaces them.
+type Transfer struct {
+        MedicineID    string         `json:"MedicineId"`
+        ContainerID   string         `json:"ContainerId,omitempty" metadata:",optional"`
+        From          string         `json:"From"`
+        To            string         `json:"To"`
+        Status        TransferStatus `json:"Status"`
+        HolderState   LifecycleState `json:"HolderState"`
+        Reason        string         `json:"Reason"`
+        InitiatedAt   time.Time      `json:"InitiatedAt"`
+        ResolvedAt    time.Time      `json:"ResolvedAt"`
+        InitiatedTxID string         `json:"InitiatedTxId"`
+        ResolvedTxID  string         `json:"ResolvedTxId"`
+}
+
+// InitiateTransfer offers custody of a medicine to receiverId. Only the
+// current holder can initiate, and only one transfer can be pending at a time.
+// Both parties must be active, licensed participants in the registry. A unit
+// packed in a container moves with its container.
+func (s *SmartContract) InitiateTransfer(ctx contractapi.TransactionContextInterface, id string, receiverId string) (*Transfer, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        medicine, err := s.ReadMedicine(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+
+        err = authorizeParticipant(ctx, medicine.ReceiverID)
+        if err != nil {
+                return nil, err
+        }
+
+        if medicine.ContainerID != "" {
+                return nil, fmt.Errorf("the medicine %s is packed in container %s, transfer the container or unpack it first",
+                        id, medicine.ContainerID)
+        }
+        err = checkTransferParties(ctx, medicine.ReceiverID, receiverId)
+        if err != nil {
+                return nil, err
+        }
+
+        transfer, err := startTransfer(ctx, medicine, receiverId, "")
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventTransferInitiated, Medicine: medicine, Transfer: transfer})
+        if err != nil {
+                return nil, err
+        }
+
+        return transfer, nil
+}
+
+// AcceptTransfer completes the pending transfer of a medicine. Only the named
+// recipient can accept, after which it becomes the medicine's ReceiverId.
+func (s *SmartContract) AcceptTransfer(ctx contractapi.TransactionContextInterface, id string) (*Medicine, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        transfer, err := getPendingTransfer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = checkNotContainerTransfer(transfer)
+        if err != nil {
+                return nil, err
+        }
+
+        err = authorizeParticipant(ctx, transfer.To)
+        if err != nil {
+                return nil, err
+        }
+        err = checkTransferParties(ctx, transfer.From, transfer.To)
+        if err != nil {
+                return nil, err
+        }
+
+        _, role, err := getCallerRole(ctx)
+        if err != nil {
+                return nil, err
+        }
+        state, err := holdingState(role)
+        if err != nil {
+                return nil, err
+        }
+
+        medicine, err := s.completeTransfer(ctx, transfer, state)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineTransferred, Medicine: medicine, Transfer: transfer})
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
+}
+
+// RejectTransfer declines the pending transfer of a medicine. Only the named
+// recipient can reject; custody stays with the sender.
+func (s *SmartContract) RejectTransfer(ctx contractapi.TransactionContextInterface, id string, reason string) (*Transfer, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        transfer, err := getPendingTransfer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = checkNotContainerTransfer(transfer)
+        if err != nil {
+                return nil, err
+        }
+
+        err = authorizeParticipant(ctx, transfer.To)
+        if err != nil {
+                return nil, err
+        }
+
+        err = s.returnToHolder(ctx, transfer)
+        if err != nil {
+                return nil, err
+        }
+
+        err = resolveTransfer(ctx, transfer, TransferRejected, reason)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventTransferRejected, MedicineID: id, Transfer: transfer})
+        if err != nil {
+                return nil, err
+        }
+
+        return transfer, nil
+}
+
+// CancelTransfer withdraws the pending transfer of a medicine. Only the
+// sender that initiated it can cancel.
+func (s *SmartContract) CancelTransfer(ctx contractapi.TransactionContextInterface, id string, reason string) (*Transfer, error) {
+        err := authorize(ctx, ActionTransfer)
+        if err != nil {
+                return nil, err
+        }
+
+        transfer, err := getPendingTransfer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        err = checkNotContainerTransfer(transfer)
+        if err != nil {
+                return nil, err
+        }
+
+        err = authorizeParticipant(ctx, transfer.From)
+        if err != nil {
+                return nil, err
+        }
+
+        err = s.returnToHolder(ctx, transfer)
+        if err != nil {
+                return nil, err
+        }
+
+        err = resolveTransfer(ctx, transfer, TransferCancelled, reason)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventTransferCancelled, MedicineID: id, Transfer: transfer})
+        if err != nil {
+                return nil, err
+        }
+
+        return transfer, nil
+}
+
+// ReadTransfer returns the latest transfer of a medicine, whatever its status.
+func (s *SmartContract) ReadTransfer(ctx contractapi.TransactionContextInterface, id string) (*Transfer, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        transfer, err := getTransfer(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+        if transfer == nil {
+                return nil, fmt.Errorf("the medicine %s has never been transferred", id)
+        }
+
+        return transfer, nil
+}
+
+// GetPendingTransfers returns the pending transfers the given participant is
+// either sending or due to receive.
+func (s *SmartContract) GetPendingTransfers(ctx contractapi.TransactionContextInterface, participantId string) ([]*Transfer, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(transferParticipantIndex, []string{participantId})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get pending transfers: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var transfers []*Transfer
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over pending transfers: %v", err)
+                }
+
+                _, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to split pending transfer key: %v", err)
+                }
+                if len(attributes) != 2 {
+                        return nil, fmt.Errorf("malformed pending transfer key %q", queryResponse.Key)
+                }
+
+                transfer, err := getTransfer(ctx, attributes[1])
+                if err != nil {
+                        return nil, err
+                }
+                if transfer != nil && transfer.Status == TransferPending {
+                        transfers = append(transfers, transfer)
+                }
+        }
+
+        return transfers, nil
+}
+
+// getTransfer returns the latest transfer of a medicine, or nil if it has none.
+func getTransfer(ctx contractapi.TransactionContextInterface, medicineID string) (*Transfer, error) {
+        key, err := ctx.GetStub().CreateCompositeKey(transferObjectType, []string{medicineID})
+        if err != nil {
+                return nil, fmt.Errorf("failed to create transfer key: %v", err)
+        }
+
+        transferJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read transfer from world state: %v", err)
+        }
+        if transferJSON == nil {
+                return nil, nil
+        }
+
+        var transfer Transfer
+        err = json.Unmarshal(transferJSON, &transfer)
+        if err != nil {
+                return nil, fmt.Errorf("failed to unmarshal transfer JSON: %v", err)
+        }
+
+        return &transfer, nil
+}
+
+// getPendingTransfer returns the pending transfer of a medicine.
+func getPendingTransfer(ctx contractapi.TransactionContextInterface, medicineID string) (*Transfer, error) {
+        transfer, err := getTransfer(ctx, medicineID)
+        if err != nil {
+                return nil, err
+        }
+        if transfer == nil || transfer.Status != TransferPending {
+                return nil, fmt.Errorf("the medicine %s has no pending transfer", medicineID)
+        }
+
+        return transfer, nil
+}
+
+// putTransfer writes a transfer and keeps the participant index in step with
+// its status.
+func putTransfer(ctx contractapi.TransactionContextInterface, transfer *Transfer) error {
+        key, err := ctx.GetStub().CreateCompositeKey(transferObjectType, []string{transfer.MedicineID})
+        if err != nil {
+                return fmt.Errorf("failed to create transfer key: %v", err)
+        }
+
+        transferJSON, err := json.Marshal(transfer)
+        if err != nil {
+                return fmt.Errorf("failed to marshal transfer JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, transferJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put transfer in world state: %v", err)
+        }
+
+        for _, participantID := range []string{transfer.From, transfer.To} {
+                indexKey, err := ctx.GetStub().CreateCompositeKey(transferParticipantIndex, []string{participantID, transfer.MedicineID})
+                if err != nil {
+                        return fmt.Errorf("failed to create pending transfer index key: %v", err)
+                }
+
+                if transfer.Status == TransferPending {
+                        err = ctx.GetStub().PutState(indexKey, indexValue)
+                } else {
+                        err = ctx.GetStub().DelState(indexKey)
+                }
+                if err != nil {
+                        return fmt.Errorf("failed to update pending transfer index: %v", err)
+                }
+        }
+
+        return nil
+}
+
+// supplyChainTiers orders the participant types along the normal direction of
+// the supply chain.
+var supplyChainTiers = map[ParticipantType]int{
+        ParticipantManufacturer: 0,
+        ParticipantDistributor:  1,
+        ParticipantPharmacy:     2,
+        ParticipantHospital:     2,
+}
+
+// checkTransferParties returns an error unless a handover from sender to
+// receiver is between two different active, licensed participants and moves
+// stock down the supply chain or across it. Stock goes back up the chain
+// through ReturnMedicine.
+func checkTransferParties(ctx contractapi.TransactionContextInterface, sender string, receiver string) error {
+        if receiver == "" {
+                return fmt.Errorf("a receiver is required to transfer from %s", sender)
+        }
+        if receiver == sender {
+                return fmt.Errorf("%s cannot transfer to itself", sender)
+        }
+
+        err := checkParticipant(ctx, sender)
+        if err != nil {
+                return err
+        }
+        err = checkParticipant(ctx, receiver)
+        if err != nil {
+                return err
+        }
+
+        from, err := getParticipant(ctx, sender)
+        if err != nil {
+                return err
+        }
+        to, err := getParticipant(ctx, receiver)
+        if err != nil {
+                return err
+        }
+        if supplyChainTiers[to.Type] < supplyChainTiers[from.Type] {
+                return fmt.Errorf("a %s cannot transfer to a %s, send the stock back with ReturnMedicine instead",
+                        from.Type, to.Type)
+        }
+
+        return nil
+}
+
+// checkNotContainerTransfer returns an error if a transfer is part of the
+// transfer of a container, which is resolved as a whole.
+func checkNotContainerTransfer(transfer *Transfer) error {
+        if transfer.ContainerID != "" {
+                return fmt.Errorf("the transfer of medicine %s is part of the transfer of container %s",
+                        transfer.MedicineID, transfer.ContainerID)
+        }
+
+        return nil
+}
+
+// startTransfer moves a medicine InTransit and records a pending transfer to
+// receiverId. containerID names the container being transferred, if any. The
+// caller checks the parties and emits the event.
+func startTransfer(ctx contractapi.TransactionContextInterface, medicine *Medicine,
+        receiverId string, containerID string) (*Transfer, error) {
+        err := checkNotExpired(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        existing, err := getTransfer(ctx, medicine.ID)
+        if err != nil {
+                return nil, err
+        }
+        if existing != nil && existing.Status == TransferPending {
+                return nil, fmt.Errorf("the medicine %s already has a pending transfer to %s", medicine.ID, existing.To)
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        transfer := &Transfer{
+                MedicineID:    medicine.ID,
+                ContainerID:   containerID,
+                From:          medicine.ReceiverID,
+                To:            receiverId,
+                Status:        TransferPending,
+                HolderState:   medicine.State,
+                InitiatedAt:   now,
+                InitiatedTxID: ctx.GetStub().GetTxID(),
+        }
+
+        err = medicine.transitionTo(StateInTransit)
+        if err != nil {
+                return nil, err
+        }
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = putTransfer(ctx, transfer)
+        if err != nil {
+                return nil, err
+        }
+
+        return transfer, nil
+}
+
+// completeTransfer hands a medicine over to the recipient of its pending
+// transfer, in the given holding state. The caller checks the parties and
+// emits the event.
+func (s *SmartContract) completeTransfer(ctx contractapi.TransactionContextInterface,
+        transfer *Transfer, state LifecycleState) (*Medicine, error) {
+        medicine, err := s.ReadMedicine(ctx, transfer.MedicineID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read medicine: %v", err)
+        }
+        if medicine.ReceiverID != transfer.From {
+                return nil, fmt.Errorf("the medicine %s is no longer held by %s", medicine.ID, transfer.From)
+        }
+
+        err = checkNotExpired(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+
+        previous := *medicine
+        err = medicine.transitionTo(state)
+        if err != nil {
+                return nil, err
+        }
+        medicine.SenderID = transfer.From
+        medicine.ReceiverID = transfer.To
+        medicine.TimeStamp = now
+
+        err = putMedicine(ctx, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = updateMedicineIndexes(ctx, &previous, medicine)
+        if err != nil {
+                return nil, err
+        }
+
+        err = resolveTransfer(ctx, transfer, TransferAccepted, "")
+        if err != nil {
+                return nil, err
+        }
+
+        return medicine, nil
+}
+
+// returnToHolder moves a medicine whose transfer did not go ahead back to the
+// lifecycle state it was in with its sender. A medicine that was recalled or
+// otherwise left InTransit meanwhile keeps its state.
+func (s *SmartContract) returnToHolder(ctx contractapi.TransactionContextInterface, transfer *Transfer) error {
+        medicine, err := s.ReadMedicine(ctx, transfer.MedicineID)
+        if err != nil {
+                return fmt.Errorf("failed to read medicine: %v", err)
+        }
+        if medicine.State != StateInTransit {
+                return nil
+        }
+
+        err = medicine.transitionTo(transfer.HolderState)
+        if err != nil {
+                return err
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+        medicine.TimeStamp = now
+
+        return putMedicine(ctx, medicine)
+}
+
+// resolveTransfer moves a pending transfer to its final status.
+func resolveTransfer(ctx contractapi.TransactionContextInterface, transfer *Transfer, status TransferStatus, reason string) error {
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return err
+        }
+
+        transfer.Status = status
+        transfer.Reason = reason
+        transfer.ResolvedAt = now
+        transfer.ResolvedTxID = ctx.GetStub().GetTxID()
+
+        return putTransfer(ctx, transfer)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestTransferAcceptedByRecipient(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.releaseMedicine("M1")
+
+        _, err := ledger.contract.InitiateTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1", "PHARM1")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected a transfer initiated by a participant that does not hold M1 to be refused, got %v", err)
+        }
+        _, err = ledger.contract.InitiateTransfer(ledger.manufacturer(), "M1", "DIST1")
+        if err != nil {
+                t.Fatalf("failed to transfer M1: %v", err)
+        }
+        _, err = ledger.contract.InitiateTransfer(ledger.manufacturer(), "M1", "DIST1")
+        if err == nil {
+                t.Fatalf("expected a second pending transfer of M1 to be refused")
+        }
+
+        medicine, err := ledger.contract.ReadMedicine(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to read M1: %v", err)
+        }
+        if medicine.State != StateInTransit || medicine.ReceiverID != "MFG1" {
+                t.Fatalf("expected M1 to be InTransit and still held by MFG1, got %s held by %s", medicine.State, medicine.ReceiverID)
+        }
+
+        _, err = ledger.contract.AcceptTransfer(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected an accept by a participant that is not the recipient to be refused, got %v", err)
+        }
+        medicine, err = ledger.contract.AcceptTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1")
+        if err != nil {
+                t.Fatalf("failed to accept M1: %v", err)
+        }
+        if medicine.State != StateAtDistributor || medicine.ReceiverID != "DIST1" || medicine.SenderID != "MFG1" {
+                t.Fatalf("expected M1 to be AtDistributor, sent by MFG1 to DIST1, got %+v", medicine)
+        }
+
+        transfer, err := ledger.contract.ReadTransfer(ledger.manufacturer(), "M1")
+        if err != nil {
+                t.Fatalf("failed to read the transfer of M1: %v", err)
+        }
+        if transfer.Status != TransferAccepted {
+                t.Fatalf("expected the transfer to be %s, got %s", TransferAccepted, transfer.Status)
+        }
+}
+
+func TestTransferRejectedOrCancelledStaysWithSender(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.releaseMedicine("M1")
+
+        _, err := ledger.contract.InitiateTransfer(ledger.manufacturer(), "M1", "DIST1")
+        if err != nil {
+                t.Fatalf("failed to transfer M1: %v", err)
+        }
+        _, err = ledger.contract.RejectTransfer(ledger.manufacturer(), "M1", "wrong address")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected a reject by the sender to be refused, got %v", err)
+        }
+        transfer, err := ledger.contract.RejectTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1", "not ordered")
+        if err != nil {
+                t.Fatalf("failed to reject M1: %v", err)
+        }
+        if transfer.Status != TransferRejected || transfer.Reason != "not ordered" {
+                t.Fatalf("unexpected rejected transfer %+v", transfer)
+        }
+        ledger.expectHeldBy("M1", "MFG1", StateReleased)
+
+        _, err = ledger.contract.InitiateTransfer(ledger.manufacturer(), "M1", "DIST1")
+        if err != nil {
+                t.Fatalf("failed to transfer M1 again: %v", err)
+        }
+        _, err = ledger.contract.CancelTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1", "")
+        if _, ok := err.(*AuthorizationError); !ok {
+                t.Fatalf("expected a cancel by the recipient to be refused, got %v", err)
+        }
+        transfer, err = ledger.contract.CancelTransfer(ledger.manufacturer(), "M1", "sent by mistake")
+        if err != nil {
+                t.Fatalf("failed to cancel the transfer of M1: %v", err)
+        }
+        if transfer.Status != TransferCancelled {
+                t.Fatalf("expected the transfer to be %s, got %s", TransferCancelled, transfer.Status)
+        }
+        ledger.expectHeldBy("M1", "MFG1", StateReleased)
+
+        _, err = ledger.contract.AcceptTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1")
+        if err == nil {
+                t.Fatalf("expected accepting a cancelled transfer to fail")
+        }
+}
+
+func TestTransferMovesDownTheSupplyChain(t *testing.T) {
+        ledger := newTestLedger(t)
+        ledger.releaseMedicine("M1")
+
+        _, err := ledger.contract.InitiateTransfer(ledger.manufacturer(), "M1", "DIST1")
+        if err != nil {
+                t.Fatalf("failed to transfer M1: %v", err)
+        }
+        _, err = ledger.contract.AcceptTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1")
+        if err != nil {
+                t.Fatalf("failed to accept M1: %v", err)
+        }
+
+        _, err = ledger.contract.InitiateTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1", "MFG1")
+        if err == nil || !strings.Contains(err.Error(), "ReturnMedicine") {
+                t.Fatalf("expected a transfer back to the manufacturer to be refused, got %v", err)
+        }
+        _, err = ledger.contract.InitiateTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1", "DIST1")
+        if err == nil {
+                t.Fatalf("expected a transfer to itself to be refused")
+        }
+
+        _, err = ledger.contract.InitiateTransfer(ledger.as("Org1MSP", RoleDistributor, "DIST1"), "M1", "PHARM1")
+        if err != nil {
+                t.Fatalf("failed to transfer M1 to PHARM1: %v", err)
+        }
+        _, err = ledger.contract.AcceptTransfer(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1")
+        if err != nil {
+                t.Fatalf("failed to accept M1 at PHARM1: %v", err)
+        }
+
+        _, err = ledger.contract.InitiateTransfer(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "DIST1")
+        if err == nil || !strings.Contains(err.Error(), "ReturnMedicine") {
+                t.Fatalf("expected a transfer back to the distributor to be refused, got %v", err)
+        }
+        _, err = ledger.contract.InitiateTransfer(ledger.as("Org1MSP", RolePharmacy, "PHARM1"), "M1", "PHARM2")
+        if err != nil {
+                t.Fatalf("expected a transfer between pharmacies to be allowed, got %v", err)
+        }
+}
+
+// expectHeldBy fails the test unless the medicine is held by holder in the given state.
+func (l *testLedger) expectHeldBy(id string, holder string, state LifecycleState) {
+        medicine, err := l.contract.ReadMedicine(l.manufacturer(), id)
+        if err != nil {
+                l.t.Fatalf("failed to read %s: %v", id, err)
+        }
+        if medicine.ReceiverID != holder || medicine.State != state {
+                l.t.Fatalf("expected %s to be %s with %s, got %s with %s", id, state, holder, medicine.State, medicine.ReceiverID)
+        }
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "math"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Verdict is the outcome of an authenticity scan shown to the consumer.
+type Verdict string
+
+// Verdicts, from worst to best.
+const (
+        VerdictUnknown    Verdict = "Unknown"
+        VerdictRecalled   Verdict = "Recalled"
+        VerdictExpired    Verdict = "Expired"
+        VerdictSuspicious Verdict = "Suspicious"
+        VerdictConsumed   Verdict = "Consumed"
+        VerdictGenuine    Verdict = "Genuine"
+)
+
+// ScanFlag is a reason a scan looks like a counterfeit.
+type ScanFlag string
+
+// Scan flags.
+const (
+        FlagUnknownSerial        ScanFlag = "UnknownSerial"
+        FlagRecalled             ScanFlag = "Recalled"
+        FlagExpired              ScanFlag = "Expired"
+        FlagScannedAfterDispense ScanFlag = "ScannedAfterDispensing"
+        FlagProbableClone        ScanFlag = "ProbableClone"
+        FlagDecommissioned       ScanFlag = "Decommissioned"
+)
+
+// Clone detection: two scans of the same serial within cloneWindow whose
+// locations are more than cloneDistanceKm apart are treated as two packs
+// carrying the same serial. Locations that are not coordinates are compared
+// as place names.
+const (
+        cloneWindow     = 6 * time.Hour
+        cloneDistanceKm = 100.0
+)
+
+// scanObjectType keys scans by medicine ID and transaction ID.
+const scanObjectType = "scan"
+
+// Scan is an authenticity scan recorded on the ledger.
+type Scan struct {
+        MedicineID string     `json:"MedicineId"`
+        Location   string     `json:"Location"`
+        ScannedAt  time.Time  `json:"ScannedAt"`
+        MSPID      string     `json:"MspId"`
+        TxID       string     `json:"TxId"`
+        Verdict    Verdict    `json:"Verdict"`
+        Flags      []ScanFlag `json:"Flags"`
+}
+
+// VerificationResult is the consumer-safe view of a scanned medicine. It
+// leaves out custody and commercial details.
+type VerificationResult struct {
+        MedicineID   string         `json:"MedicineId"`
+        Verdict      Verdict        `json:"Verdict"`
+        Flags        []ScanFlag     `json:"Flags"`
+        Name         string         `json:"Name"`
+        BrandName    string         `json:"BrandName"`
+        Manufacturer string         `json:"Manufacturer"`
+        DosageForm   string         `json:"DosageForm"`
+        Batch_No     string         `json:"Batch_No"`
+        ExpiryDate   time.Time      `json:"ExpiryDate"`
+        State        LifecycleState `json:"State"`
+        ScanCount    int            `json:"ScanCount"`
+        ScannedAt    time.Time      `json:"ScannedAt"`
+}
+
+// VerifyMedicine records an authenticity scan of a medicine at the given
+// location and returns what the consumer should be told about it. The scan is
+// recorded even when the serial is unknown, so that counterfeit serials can be
+// traced. scannerLocation is either "latitude,longitude" or a place name.
+func (s *SmartContract) VerifyMedicine(ctx contractapi.TransactionContextInterface,
+        id string, scannerLocation string) (*VerificationResult, error) {
+        err := authorize(ctx, ActionVerify)
+        if err != nil {
+                return nil, err
+        }
+
+        if id == "" {
+                return nil, fmt.Errorf("a medicine ID is required to verify")
+        }
+
+        now, err := txTimestamp(ctx)
+        if err != nil {
+                return nil, err
+        }
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+
+        previousScans, err := getScans(ctx, id)
+        if err != nil {
+                return nil, err
+        }
+
+        result := &VerificationResult{
+                MedicineID: id,
+                Flags:      []ScanFlag{},
+                ScanCount:  len(previousScans) + 1,
+                ScannedAt:  now,
+        }
+
+        exists, err := s.MedicineExists(ctx, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to check medicine existence: %v", err)
+        }
+
+        if !exists {
+                result.Flags = append(result.Flags, FlagUnknownSerial)
+        } else {
+                medicine, err := s.ReadMedicine(ctx, id)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to read medicine: %v", err)
+                }
+
+                result.Name = medicine.Name
+                result.BrandName = medicine.BrandName
+                result.Manufacturer = medicine.Manufacturer
+                result.DosageForm = medicine.DosageForm
+                result.Batch_No = medicine.Batch_No
+                result.ExpiryDate = medicine.ExpiryDate
+                result.State = medicine.State
+
+                if medicine.State == StateRecalled {
+                        result.Flags = append(result.Flags, FlagRecalled)
+                }
+                if medicine.ExpiryDate.IsZero() || isExpired(medicine, now) {
+                        result.Flags = append(result.Flags, FlagExpired)
+                }
+                if medicine.State == StateDispensed {
+                        result.Flags = append(result.Flags, FlagScannedAfterDispense)
+                }
+                if medicine.State == StateDecommissioned || medicine.State == StateDestroyed {
+                        result.Flags = append(result.Flags, FlagDecommissioned)
+                }
+        }
+
+        for _, previous := range previousScans {
+                if now.Sub(previous.ScannedAt) <= cloneWindow && locationsFarApart(previous.Location, scannerLocation) {
+                        result.Flags = append(result.Flags, FlagProbableClone)
+                        break
+                }
+        }
+
+        result.Verdict = verdictFor(result.Flags)
+
+        scan := &Scan{
+                MedicineID: id,
+                Location:   scannerLocation,
+                ScannedAt:  now,
+                MSPID:      mspID,
+                TxID:       ctx.GetStub().GetTxID(),
+                Verdict:    result.Verdict,
+                Flags:      result.Flags,
+        }
+        err = putScan(ctx, scan)
+        if err != nil {
+                return nil, err
+        }
+
+        err = emitEvent(ctx, &ChaincodeEvent{Type: EventMedicineVerified, MedicineID: id, Scan: scan})
+        if err != nil {
+                return nil, err
+        }
+
+        return result, nil
+}
+
+// GetMedicineScans returns every authenticity scan recorded for a medicine.
+func (s *SmartContract) GetMedicineScans(ctx contractapi.TransactionContextInterface, id string) ([]*Scan, error) {
+        err := authorize(ctx, ActionRead)
+        if err != nil {
+                return nil, err
+        }
+
+        return getScans(ctx, id)
+}
+
+// verdictFor returns the verdict for the most serious flag raised.
+func verdictFor(flags []ScanFlag) Verdict {
+        verdict := VerdictGenuine
+        rank := map[Verdict]int{
+                VerdictGenuine:    0,
+                VerdictConsumed:   1,
+                VerdictSuspicious: 2,
+                VerdictExpired:    3,
+                VerdictRecalled:   4,
+                VerdictUnknown:    5,
+        }
+
+        for _, flag := range flags {
+                var candidate Verdict
+                switch flag {
+                case FlagUnknownSerial:
+                        candidate = VerdictUnknown
+                case FlagRecalled:
+                        candidate = VerdictRecalled
+                case FlagExpired:
+                        candidate = VerdictExpired
+                case FlagScannedAfterDispense:
+                        candidate = VerdictConsumed
+                default:
+                        candidate = VerdictSuspicious
+                }
+                if rank[candidate] > rank[verdict] {
+                        verdict = candidate
+                }
+        }
+
+        return verdict
+}
+
+// locationsFarApart reports whether two scan locations are too far apart to
+// be the same pack. Coordinates are compared by great-circle distance and
+// place names by name. A coordinate and a place name, or a missing location,
+// cannot be compared and are never reported as far apart.
+func locationsFarApart(a string, b string) bool {
+        a = strings.TrimSpace(a)
+        b = strings.TrimSpace(b)
+        if a == "" || b == "" {
+                return false
+        }
+
+        latA, lonA, okA := parseCoordinates(a)
+        latB, lonB, okB := parseCoordinates(b)
+        if okA && okB {
+                return haversineKm(latA, lonA, latB, lonB) > cloneDistanceKm
+        }
+        if okA || okB {
+                return false
+        }
+
+        return !strings.EqualFold(a, b)
+}
+
+// parseCoordinates parses a "latitude,longitude" location.
+func parseCoordinates(location string) (float64, float64, bool) {
+        parts := strings.Split(location, ",")
+        if len(parts) != 2 {
+                return 0, 0, false
+        }
+
+        lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+        if err != nil || lat < -90 || lat > 90 {
+                return 0, 0, false
+        }
+        lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if err != nil || lon < -180 || lon > 180 {
+                return 0, 0, false
+        }
+
+        return lat, lon, true
+}
+
+// haversineKm returns the great-circle distance between two points in kilometres.
+func haversineKm(latA float64, lonA float64, latB float64, lonB float64) float64 {
+        const earthRadiusKm = 6371.0
+        toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+        dLat := toRadians(latB - latA)
+        dLon := toRadians(lonB - lonA)
+        h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+                math.Cos(toRadians(latA))*math.Cos(toRadians(latB))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+        return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// getScans returns the scans recorded for a medicine.
+func getScans(ctx contractapi.TransactionContextInterface, id string) ([]*Scan, error) {
+        resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(scanObjectType, []string{id})
+        if err != nil {
+                return nil, fmt.Errorf("failed to get scans from world state: %v", err)
+        }
+        defer resultsIterator.Close()
+
+        var scans []*Scan
+        for resultsIterator.HasNext() {
+                queryResponse, err := resultsIterator.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("failed to iterate over scans: %v", err)
+                }
+
+                var scan Scan
+                err = json.Unmarshal(queryResponse.Value, &scan)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal scan JSON: %v", err)
+                }
+                scans = append(scans, &scan)
+        }
+
+        return scans, nil
+}
+
+// putScan writes a scan under the medicine ID and the transaction ID.
+func putScan(ctx contractapi.TransactionContextInterface, scan *Scan) error {
+        key, err := ctx.GetStub().CreateCompositeKey(scanObjectType, []string{scan.MedicineID, scan.TxID})
+        if err != nil {
+                return fmt.Errorf("failed to create scan key: %v", err)
+        }
+
+        scanJSON, err := json.Marshal(scan)
+        if err != nil {
+                return fmt.Errorf("failed to marshal scan JSON: %v", err)
+        }
+
+        err = ctx.GetStub().PutState(key, scanJSON)
+        if err != nil {
+                return fmt.Errorf("failed to put scan in world state: %v", err)
+        }
+
+        return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestLocationsFarApart(t *testing.T) {
+        tests := []struct {
+                a        string
+                b        string
+                farApart bool
+        }{
+                {"31.5204,74.3587", "24.8607,67.0011", true},
+                {"31.5204,74.3587", "31.5210,74.3590", false},
+                {"Lahore", "Karachi", true},
+                {"Lahore", " lahore ", false},
+                {"31.5204,74.3587", "Lahore", false},
+                {"Karachi", "31.5204,74.3587", false},
+                {"", "Lahore", false},
+                {"31.5204,74.3587", "", false},
+        }
+
+        for _, test := range tests {
+                if got := locationsFarApart(test.a, test.b); got != test.farApart {
+                        t.Errorf("locationsFarApart(%q, %q) = %v, want %v", test.a, test.b, got, test.farApart)
+                }
+        }
+}
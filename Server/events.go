@@ -0,0 +1,206 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "log"
+        "sync"
+        "time"
+
+        "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+        "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// eventFilter matches every event emitted by the medicine chaincode.
+const eventFilter = ".*"
+
+// supportedEventVersion is the newest chaincode event payload version this
+// server understands.
+const supportedEventVersion = 1
+
+// MedicineEvent mirrors the payload of the chaincode's events. The nested
+// objects are kept raw and forwarded as they are.
+type MedicineEvent struct {
+        Version      int             `json:"Version"`
+        Type         string          `json:"Type"`
+        MedicineID   string          `json:"MedicineId"`
+        BatchNo      string          `json:"Batch_No"`
+        TxID         string          `json:"TxId"`
+        Timestamp    time.Time       `json:"Timestamp"`
+        MSPID        string          `json:"MspId"`
+        Medicine     json.RawMessage `json:"Medicine,omitempty"`
+        Transfer     json.RawMessage `json:"Transfer,omitempty"`
+        Recall       json.RawMessage `json:"Recall,omitempty"`
+        Scan         json.RawMessage `json:"Scan,omitempty"`
+        Container    json.RawMessage `json:"Container,omitempty"`
+        Units        []string        `json:"Units,omitempty"`
+        Dispensation json.RawMessage `json:"Dispensation,omitempty"`
+        Return       json.RawMessage `json:"Return,omitempty"`
+}
+
+// Notification is the application-level message produced for each chaincode event.
+type Notification struct {
+        Type        string          `json:"Type"`
+        Message     string          `json:"Message"`
+        MedicineID  string          `json:"MedicineId,omitempty"`
+        BatchNo     string          `json:"Batch_No,omitempty"`
+        TxID        string          `json:"TxId"`
+        BlockNumber uint64          `json:"BlockNumber"`
+        Timestamp   time.Time       `json:"Timestamp"`
+        Event       json.RawMessage `json:"Event"`
+}
+
+// NotificationLog keeps the most recent notifications in memory for /notifications.
+type NotificationLog struct {
+        mu            sync.Mutex
+        notifications []Notification
+        size          int
+}
+
+func NewNotificationLog(size int) *NotificationLog {
+        return &NotificationLog{size: size}
+}
+
+func (l *NotificationLog) Add(notification Notification) {
+        l.mu.Lock()
+        defer l.mu.Unlock()
+
+        l.notifications = append(l.notifications, notification)
+        if len(l.notifications) > l.size {
+                l.notifications = l.notifications[len(l.notifications)-l.size:]
+        }
+}
+
+// Recent returns the stored notifications, newest last.
+func (l *NotificationLog) Recent() []Notification {
+        l.mu.Lock()
+        defer l.mu.Unlock()
+
+        recent := make([]Notification, len(l.notifications))
+        copy(recent, l.notifications)
+        return recent
+}
+
+// ListenForEvents registers a contract event listener that turns every
+// chaincode event into a notification. The returned function unregisters it.
+func ListenForEvents(contract *gateway.Contract, notifications *NotificationLog) (func(), error) {
+        registration, events, err := contract.RegisterEvent(eventFilter)
+        if err != nil {
+                return nil, err
+        }
+
+        go func() {
+                for event := range events {
+                        notification, err := toNotification(event)
+                        if err != nil {
+                                log.Printf("Ignoring chaincode event %s in tx %s: %v", event.EventName, event.TxID, err)
+                                continue
+                        }
+
+                        log.Printf("<-- Notification: %s", notification.Message)
+                        notifications.Add(notification)
+                }
+        }()
+
+        return func() { contract.Unregister(registration) }, nil
+}
+
+func toNotification(event *fab.CCEvent) (Notification, error) {
+        var payload MedicineEvent
+        err := json.Unmarshal(event.Payload, &payload)
+        if err != nil {
+                return Notification{}, fmt.Errorf("failed to parse payload: %v", err)
+        }
+        if payload.Version > supportedEventVersion {
+                return Notification{}, fmt.Errorf("unsupported payload version %d", payload.Version)
+        }
+
+        return Notification{
+                Type:        event.EventName,
+                Message:     describeEvent(event.EventName, payload),
+                MedicineID:  payload.MedicineID,
+                BatchNo:     payload.BatchNo,
+                TxID:        event.TxID,
+                BlockNumber: event.BlockNumber,
+                Timestamp:   payload.Timestamp,
+                Event:       event.Payload,
+        }, nil
+}
+
+func describeEvent(eventName string, payload MedicineEvent) string {
+        switch eventName {
+        case "MedicineCreated":
+                return fmt.Sprintf("Medicine %s was created by %s", payload.MedicineID, payload.MSPID)
+        case "MedicineUpdated":
+                return fmt.Sprintf("Medicine %s was updated by %s", payload.MedicineID, payload.MSPID)
+        case "MedicineDeleted":
+                return fmt.Sprintf("Medicine %s was deleted by %s", payload.MedicineID, payload.MSPID)
+        case "MedicineDecommissioned":
+                var medicine struct {
+                        DecommissionReason string `json:"DecommissionReason"`
+                }
+                json.Unmarshal(payload.Medicine, &medicine)
+                return fmt.Sprintf("Medicine %s was decommissioned as %s", payload.MedicineID, medicine.DecommissionReason)
+        case "JourneyCompleted":
+                var dispensation struct {
+                        PharmacyID string `json:"PharmacyId"`
+                }
+                json.Unmarshal(payload.Dispensation, &dispensation)
+                return fmt.Sprintf("Medicine %s completed its journey, dispensed by %s", payload.MedicineID, dispensation.PharmacyID)
+        case "ReturnInitiated", "ReturnAcknowledged", "ReturnRejected", "ReturnCancelled":
+                var ret struct {
+                        From   string `json:"From"`
+                        To     string `json:"To"`
+                        Reason string `json:"Reason"`
+                }
+                json.Unmarshal(payload.Return, &ret)
+                return fmt.Sprintf("%s event for medicine %s returned by %s to %s as %s",
+                        eventName, payload.MedicineID, ret.From, ret.To, ret.Reason)
+        case "MedicineReleased":
+                return fmt.Sprintf("Medicine %s was released for distribution", payload.MedicineID)
+        case "TransferInitiated":
+                return fmt.Sprintf("Medicine %s is awaiting acceptance by its recipient", payload.MedicineID)
+        case "MedicineTransferred":
+                return fmt.Sprintf("Medicine %s changed custody", payload.MedicineID)
+        case "TransferRejected":
+                return fmt.Sprintf("Transfer of medicine %s was rejected", payload.MedicineID)
+        case "TransferCancelled":
+                return fmt.Sprintf("Transfer of medicine %s was cancelled", payload.MedicineID)
+        case "BatchRecalled", "RecallClosed":
+                var recall struct {
+                        Manufacturer string `json:"Manufacturer"`
+                }
+                json.Unmarshal(payload.Recall, &recall)
+                if eventName == "RecallClosed" {
+                        return fmt.Sprintf("Recall of batch %s of %s was closed", payload.BatchNo, recall.Manufacturer)
+                }
+                return fmt.Sprintf("Batch %s of %s was recalled", payload.BatchNo, recall.Manufacturer)
+        case "MedicineVerified":
+                var scan struct {
+                        Location string   `json:"Location"`
+                        Verdict  string   `json:"Verdict"`
+                        Flags    []string `json:"Flags"`
+                }
+                json.Unmarshal(payload.Scan, &scan)
+                if len(scan.Flags) > 0 {
+                        return fmt.Sprintf("Medicine %s scanned at %s: %s %v", payload.MedicineID, scan.Location, scan.Verdict, scan.Flags)
+                }
+                return fmt.Sprintf("Medicine %s scanned at %s: %s", payload.MedicineID, scan.Location, scan.Verdict)
+        case "ContainerPacked", "ContainerUnpacked", "ContainerTransferInitiated", "ContainerTransferred",
+                "ContainerTransferRejected", "ContainerTransferCancelled", "ContainerRecalled":
+                var container struct {
+                        ID   string `json:"ID"`
+                        Type string `json:"Type"`
+                }
+                json.Unmarshal(payload.Container, &container)
+                return fmt.Sprintf("%s event for %s %s covering %d medicines", eventName, container.Type, container.ID, len(payload.Units))
+        case "MedicinesCreated":
+                return fmt.Sprintf("%d medicines were created by %s", len(payload.Units), payload.MSPID)
+        case "MedicinesTransferInitiated":
+                return fmt.Sprintf("%d medicines are awaiting acceptance by their recipient", len(payload.Units))
+        case "MedicinesExpired":
+                return fmt.Sprintf("%d medicines were taken out of the supply chain as expired", len(payload.Units))
+        default:
+                return fmt.Sprintf("%s event for medicine %s", eventName, payload.MedicineID)
+        }
+}
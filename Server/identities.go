@@ -0,0 +1,95 @@
+package main
+
+import (
+        "fmt"
+        "net/http"
+        "path/filepath"
+        "sync"
+
+        "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// participantHeader names the participant a request acts as. Custody
+// handovers, releases, containers, returns, dispensing, the catalog, updates,
+// decommissioning, expiry and commercial terms check that the signing
+// certificate is bound to the SenderId/ReceiverId it acts for, so those routes
+// sign with the wallet identity labelled with the participant ID instead of
+// appUser.
+//
+// Enroll such identities with both attributes in the certificate, e.g.
+//
+//	fabric-ca-client register --id.name pharm1 \
+//	        --id.attrs 'role=pharmacy:ecert,participantId=PHARM1:ecert'
+//
+// and put them in the wallet under the participant ID (wallet/PHARM1.id).
+const participantHeader = "X-Participant-Id"
+
+// mspProfiles maps an identity's MSP to the connection profile of its organisation.
+var mspProfiles = map[string]string{
+        "Org1MSP": filepath.Join("org1.example.com", "connection-org1.yaml"),
+        "Org2MSP": filepath.Join("org2.example.com", "connection-org2.yaml"),
+        "Org3MSP": filepath.Join("org3.example.com", "connection-org3.yaml"),
+        "Org4MSP": filepath.Join("org4.example.com", "connection-org4.yaml"),
+}
+
+// ParticipantGateways keeps one gateway per participant-bound identity.
+type ParticipantGateways struct {
+        wallet   *gateway.Wallet
+        mu       sync.Mutex
+        gateways map[string]*gateway.Gateway
+}
+
+func NewParticipantGateways(wallet *gateway.Wallet) *ParticipantGateways {
+        return &ParticipantGateways{wallet: wallet, gateways: map[string]*gateway.Gateway{}}
+}
+
+// Contract returns the contract signed by the identity of the participant
+// named in the request's X-Participant-Id header, connecting on first use.
+func (p *ParticipantGateways) Contract(r *http.Request) (*gateway.Contract, error) {
+        id := r.Header.Get(participantHeader)
+        if id == "" {
+                return nil, fmt.Errorf("the %s header is required to act as a participant", participantHeader)
+        }
+        if filepath.Base(id) != id {
+                return nil, fmt.Errorf("invalid participant ID %q", id)
+        }
+
+        p.mu.Lock()
+        defer p.mu.Unlock()
+
+        gw, ok := p.gateways[id]
+        if !ok {
+                if !p.wallet.Exists(id) {
+                        return nil, fmt.Errorf("no identity for participant %s in the wallet", id)
+                }
+                identity, err := p.wallet.Get(id)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to read the identity of participant %s: %v", id, err)
+                }
+                x509, ok := identity.(*gateway.X509Identity)
+                if !ok {
+                        return nil, fmt.Errorf("the identity of participant %s is not an X.509 identity", id)
+                }
+                if _, ok := mspProfiles[x509.MspID]; !ok {
+                        return nil, fmt.Errorf("no connection profile for %s", x509.MspID)
+                }
+
+                gw, err = connectGateway(p.wallet, walletIdentity{Label: id, MSPID: x509.MspID})
+                if err != nil {
+                        return nil, fmt.Errorf("failed to connect to gateway as participant %s: %v", id, err)
+                }
+                p.gateways[id] = gw
+        }
+
+        return getContract(gw, "mychannel", "basic"), nil
+}
+
+// Close closes every participant gateway.
+func (p *ParticipantGateways) Close() {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+
+        for _, gw := range p.gateways {
+                gw.Close()
+        }
+}
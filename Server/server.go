@@ -1,6 +1,9 @@
 package main
 
 import (
+        "crypto/hmac"
+        "crypto/sha256"
+        "encoding/hex"
         "encoding/json"
         "io/ioutil"
         "log"
@@ -8,8 +11,9 @@ import (
         "os"
         "os/signal"
         "path/filepath"
+        "strconv"
+        "strings"
         "syscall"
-        "time"
 
         "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
         "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
@@ -28,32 +32,42 @@ func main() {
                 log.Fatalf("Failed to create wallet: %v", err)
         }
 
-        if !wallet.Exists("appUser") {
-                err = populateWallet(wallet)
-                if err != nil {
-                        log.Fatalf("Failed to populate wallet contents: %v", err)
+        for _, identity := range []walletIdentity{appIdentity, regulatorIdentity} {
+                if !wallet.Exists(identity.Label) {
+                        err = populateWallet(wallet, identity)
+                        if err != nil {
+                                log.Fatalf("Failed to populate wallet contents: %v", err)
+                        }
                 }
         }
 
-        ccpPath := filepath.Join(
-                "..",
-                "..",
-                "test-network",
-                "organizations",
-                "peerOrganizations",
-                "org1.example.com",
-                "connection-org1.yaml",
-        )
-
-        gw, err := gateway.Connect(
-                gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
-                gateway.WithIdentity(wallet, "appUser"),
-        )
+        gw, err := connectGateway(wallet, appIdentity)
         if err != nil {
                 log.Fatalf("Failed to connect to gateway: %v", err)
         }
         defer gw.Close()
 
+        // Recalls and the registries are regulator only, and the chaincode
+        // only accepts regulators from Org2MSP, so those routes sign as an
+        // Org2 user through their own gateway.
+        regulatorGw, err := connectGateway(wallet, regulatorIdentity)
+        if err != nil {
+                log.Fatalf("Failed to connect to gateway as the regulator: %v", err)
+        }
+        defer regulatorGw.Close()
+
+        // Routes acting for a supply-chain participant sign as that participant,
+        // see participantHeader.
+        participants := NewParticipantGateways(wallet)
+        defer participants.Close()
+
+        notifications := NewNotificationLog(100)
+        unregister, err := ListenForEvents(getContract(gw, "mychannel", "basic"), notifications)
+        if err != nil {
+                log.Fatalf("Failed to register contract event listener: %v", err)
+        }
+        defer unregister()
+
         http.HandleFunc("/initLedger", func(w http.ResponseWriter, r *http.Request) {
                 if r.Method != http.MethodGet {
                         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -70,14 +84,1383 @@ func main() {
                 w.Write(result)
         })
 
-        http.HandleFunc("/medicines", func(w http.ResponseWriter, r *http.Request) {
-                if r.Method != http.MethodGet {
+        http.HandleFunc("/initRegistry", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                contract := getContract(regulatorGw, "mychannel", "basic")
+                result, err := InitRegistryTransaction(contract)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/medicines", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+
+                // Without a limit the whole world state is returned in one response
+                query := r.URL.Query()
+                if query.Get("limit") == "" {
+                        result, err := GetAllMedicinesTransaction(contract)
+                        if err != nil {
+                                http.Error(w, err.Error(), http.StatusInternalServerError)
+                                return
+                        }
+
+                        w.Write(result)
+                        return
+                }
+
+                limit, err := strconv.ParseInt(query.Get("limit"), 10, 32)
+                if err != nil || limit <= 0 {
+                        http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+                        return
+                }
+
+                result, err := GetAllMedicinesWithPaginationTransaction(contract, int32(limit), query.Get("bookmark"))
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var medicine GetMedicine
+                err = json.Unmarshal(body, &medicine)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetMedicineTransaction(contract, medicine.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        // /journey is kept for existing clients; the chaincode refuses it, use /dispense.
+        http.HandleFunc("/journey", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var medicine GetMedicine
+                err = json.Unmarshal(body, &medicine)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := MedicineJourneyTransaction(contract, medicine.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/dispense", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var dispense DispenseRequest
+                err = json.Unmarshal(body, &dispense)
+                if err != nil || dispense.PatientRef == "" {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                salt := os.Getenv(patientRefSaltEnv)
+                if salt == "" {
+                        http.Error(w, patientRefSaltEnv+" is not set, patient references cannot be pseudonymised", http.StatusInternalServerError)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := DispenseMedicineTransaction(contract, dispense.ID, dispense.PharmacyID,
+                        pseudonymisePatientRef(salt, dispense.PatientRef))
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/dispensation/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                id := r.URL.Query().Get("id")
+                if id == "" {
+                        http.Error(w, "id query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := ReadDispensationTransaction(contract, id)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/release", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var medicine GetMedicine
+                err = json.Unmarshal(body, &medicine)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := ReleaseMedicineTransaction(contract, medicine.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var medicine GetMedicine
+                err = json.Unmarshal(body, &medicine)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetMedicineHistoryTransaction(contract, medicine.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/provenance", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var medicine GetMedicine
+                err = json.Unmarshal(body, &medicine)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetMedicineProvenanceTransaction(contract, medicine.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var query MedicineQuery
+                err = json.Unmarshal(body, &query)
+                if err != nil || len(query.Selector) == 0 {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+                if query.Limit < 0 {
+                        http.Error(w, "Limit must not be negative", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := QueryMedicinesTransaction(contract, query)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/transfer", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var transfer TransferRequest
+                err = json.Unmarshal(body, &transfer)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := InitiateTransferTransaction(contract, transfer.ID, transfer.ReceiverID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/transfer/bulk", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var transfer BulkTransferRequest
+                err = json.Unmarshal(body, &transfer)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := TransferMedicinesTransaction(contract, transfer.IDs, transfer.SenderID, transfer.ReceiverID)
+                if err != nil {
+                        if writeBulkError(w, err) {
+                                return
+                        }
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/transfer/accept", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var transfer TransferRequest
+                err = json.Unmarshal(body, &transfer)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := AcceptTransferTransaction(contract, transfer.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/transfer/reject", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var transfer TransferRequest
+                err = json.Unmarshal(body, &transfer)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := RejectTransferTransaction(contract, transfer.ID, transfer.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/transfer/cancel", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var transfer TransferRequest
+                err = json.Unmarshal(body, &transfer)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := CancelTransferTransaction(contract, transfer.ID, transfer.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/transfers", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                participant := r.URL.Query().Get("participant")
+                if participant == "" {
+                        http.Error(w, "participant query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetPendingTransfersTransaction(contract, participant)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/return", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var ret ReturnRequest
+                err = json.Unmarshal(body, &ret)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := ReturnMedicineTransaction(contract, ret.ID, ret.ManufacturerID, ret.Reason, ret.Note)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/return/acknowledge", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var medicine GetMedicine
+                err = json.Unmarshal(body, &medicine)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := AcknowledgeReturnTransaction(contract, medicine.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/return/reject", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var ret TransferRequest
+                err = json.Unmarshal(body, &ret)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := RejectReturnTransaction(contract, ret.ID, ret.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/return/cancel", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var ret TransferRequest
+                err = json.Unmarshal(body, &ret)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := CancelReturnTransaction(contract, ret.ID, ret.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/return/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                id := r.URL.Query().Get("id")
+                if id == "" {
+                        http.Error(w, "id query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := ReadReturnTransaction(contract, id)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/returns", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                participant := r.URL.Query().Get("participant")
+                if participant == "" {
+                        http.Error(w, "participant query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetPendingReturnsTransaction(contract, participant)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/inventory", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                holder := r.URL.Query().Get("holder")
+                if holder == "" {
+                        http.Error(w, "holder query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetHolderInventoryTransaction(contract, holder)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/recall", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var recall RecallRequest
+                err = json.Unmarshal(body, &recall)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(regulatorGw, "mychannel", "basic")
+                result, err := RecallBatchTransaction(contract, recall.Manufacturer, recall.BatchNo, recall.Reason, recall.Severity)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/recalls", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetActiveRecallsTransaction(contract)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/registration", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var registration RegistrationRequest
+                err = json.Unmarshal(body, &registration)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(regulatorGw, "mychannel", "basic")
+                result, err := RegisterDRAPProductTransaction(contract, registration)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/registration/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                drapNo := r.URL.Query().Get("drapNo")
+                if drapNo == "" {
+                        http.Error(w, "drapNo query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := ReadDRAPRegistrationTransaction(contract, drapNo)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/registrations", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetDRAPRegistrationsTransaction(contract)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/participant", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var participant ParticipantRequest
+                err = json.Unmarshal(body, &participant)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(regulatorGw, "mychannel", "basic")
+                result, err := RegisterParticipantTransaction(contract, participant)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/participant/status", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var status ParticipantStatusRequest
+                err = json.Unmarshal(body, &status)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(regulatorGw, "mychannel", "basic")
+                result, err := SetParticipantStatusTransaction(contract, status.ID, status.Status, status.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/participant/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                id := r.URL.Query().Get("id")
+                if id == "" {
+                        http.Error(w, "id query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := ReadParticipantTransaction(contract, id)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/participants", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetParticipantsTransaction(contract)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/product", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var product ProductRequest
+                err = json.Unmarshal(body, &product)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := AddProductTransaction(contract, product)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/product/correct", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var product ProductRequest
+                err = json.Unmarshal(body, &product)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := CorrectProductTransaction(contract, product)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/product/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                gtin := r.URL.Query().Get("gtin")
+                if gtin == "" {
+                        http.Error(w, "gtin query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := ReadProductTransaction(contract, gtin)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetProductsTransaction(contract)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := CreateContainerTransaction(contract, container.ID, container.Type)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/pack", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := PackContainerTransaction(contract, container.ID, container.Children)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/unpack", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := UnpackContainerTransaction(contract, container.ID, container.Children)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/transfer", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := TransferContainerTransaction(contract, container.ID, container.ReceiverID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/accept", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := AcceptContainerTransferTransaction(contract, container.ID)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/reject", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := RejectContainerTransferTransaction(contract, container.ID, container.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/cancel", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := CancelContainerTransferTransaction(contract, container.ID, container.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/recall", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var container ContainerRequest
+                err = json.Unmarshal(body, &container)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(regulatorGw, "mychannel", "basic")
+                result, err := RecallContainerTransaction(contract, container.ID, container.Reason)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                id := r.URL.Query().Get("id")
+                if id == "" {
+                        http.Error(w, "id query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := ReadContainerTransaction(contract, id)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/container/units", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                id := r.URL.Query().Get("id")
+                if id == "" {
+                        http.Error(w, "id query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetContainerUnitsTransaction(contract, id)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/expire", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var expire ExpireRequest
+                err = json.Unmarshal(body, &expire)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := ExpireMedicinesTransaction(contract, expire.Holder)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/expiring", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                query := r.URL.Query()
+                if query.Get("before") == "" {
+                        http.Error(w, "before query parameter is required", http.StatusBadRequest)
+                        return
+                }
+
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := GetMedicinesExpiringBeforeTransaction(contract, query.Get("before"), query.Get("holder"))
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/terms", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var terms CommercialTermsRequest
+                err = json.Unmarshal(body, &terms)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
+
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := PutCommercialTermsTransaction(contract, terms.ID, terms.Counterparty, terms.Terms)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                w.Write(result)
+        })
+
+        http.HandleFunc("/terms/get", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
                         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
                         return
                 }
+                body, err := ioutil.ReadAll(r.Body)
+                if err != nil {
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
+                        return
+                }
+
+                var terms CommercialTermsRequest
+                err = json.Unmarshal(body, &terms)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
 
                 contract := getContract(gw, "mychannel", "basic")
-                result, err := GetAllMedicinesTransaction(contract)
+                result, err := ReadCommercialTermsTransaction(contract, terms.ID, terms.Counterparty)
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         return
@@ -86,7 +1469,7 @@ func main() {
                 w.Write(result)
         })
 
-        http.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+        http.HandleFunc("/terms/verify", func(w http.ResponseWriter, r *http.Request) {
                 if r.Method != http.MethodPost {
                         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
                         return
@@ -97,15 +1480,15 @@ func main() {
                         return
                 }
 
-                var medicine GetMedicine
-                err = json.Unmarshal(body, &medicine)
+                var terms CommercialTermsRequest
+                err = json.Unmarshal(body, &terms)
                 if err != nil {
                         http.Error(w, "Failed to parse request body", http.StatusBadRequest)
                         return
                 }
 
                 contract := getContract(gw, "mychannel", "basic")
-                result, err := GetMedicineTransaction(contract, medicine.ID)
+                result, err := VerifyCommercialTermsTransaction(contract, terms.ID, terms.MSPID, terms.Counterparty)
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         return
@@ -114,7 +1497,7 @@ func main() {
                 w.Write(result)
         })
 
-        http.HandleFunc("/journey", func(w http.ResponseWriter, r *http.Request) {
+        http.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
                 if r.Method != http.MethodPost {
                         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
                         return
@@ -125,24 +1508,25 @@ func main() {
                         return
                 }
 
-                var medicine GetMedicine
-                err = json.Unmarshal(body, &medicine)
+                var scan VerifyRequest
+                err = json.Unmarshal(body, &scan)
                 if err != nil {
                         http.Error(w, "Failed to parse request body", http.StatusBadRequest)
                         return
                 }
 
                 contract := getContract(gw, "mychannel", "basic")
-                result, err := MedicineJourneyTransaction(contract, medicine.ID)
+                result, err := VerifyMedicineTransaction(contract, scan.ID, scan.Location)
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         return
                 }
 
+                w.Header().Set("Content-Type", "application/json")
                 w.Write(result)
         })
 
-        http.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+        http.HandleFunc("/decommission", func(w http.ResponseWriter, r *http.Request) {
                 if r.Method != http.MethodPost {
                         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
                         return
@@ -153,15 +1537,19 @@ func main() {
                         return
                 }
 
-                var medicine GetMedicine
-                err = json.Unmarshal(body, &medicine)
+                var decommission DecommissionRequest
+                err = json.Unmarshal(body, &decommission)
                 if err != nil {
                         http.Error(w, "Failed to parse request body", http.StatusBadRequest)
                         return
                 }
 
-                contract := getContract(gw, "mychannel", "basic")
-                result, err := GetMedicineHistoryTransaction(contract, medicine.ID)
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
+                result, err := DecommissionMedicineTransaction(contract, decommission.ID, decommission.Reason, decommission.Note)
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         return
@@ -185,7 +1573,8 @@ func main() {
                         return
                 }
 
-                // Parse the JSON request body into a Medicine struct
+                // Check the body is a Medicine4 document; the chaincode validates
+                // the fields against its contract metadata
                 var medicine Medicine4
                 err = json.Unmarshal(body, &medicine)
                 if err != nil {
@@ -193,34 +1582,56 @@ func main() {
                         return
                 }
 
-                currentTime := time.Now()
-                formattedTime := currentTime.Format("2006-01-02 15:04:02 -0700 MST")
-
-                medicine.TimeStamp = formattedTime
-
-                result, err := CreateMedicineTransaction(contract,
-                        medicine.ID, medicine.Name, medicine.Manufacturer, medicine.ManufactureDate, medicine.ExpiryDate,
-                        medicine.BrandName, medicine.Composition, medicine.SenderID, medicine.ReceiverID,
-                        medicine.DRAPNo, medicine.DosageForm, medicine.TimeStamp, medicine.Batch_No, medicine.JourneyCompleted)
+                result, err := CreateMedicineTransaction(contract, string(body))
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         log.Println("Error submitting CreateMedicineTransaction:", err)
                         return
                 }
-                log.Println("success ", result)
+                log.Println("success ", medicine.ID)
+
+                // Set the appropriate Content-Type header
+                w.Header().Set("Content-Type", "application/json")
+
+                // Write the created medicine as stored on the ledger
+                w.Write(result)
+        })
+
+        http.HandleFunc("/create/bulk", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodPost {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
 
-                // Convert the medicine struct to JSON
-                jsonResponse, err := json.Marshal(medicine)
+                body, err := ioutil.ReadAll(r.Body)
                 if err != nil {
-                        http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+                        http.Error(w, "Failed to read request body", http.StatusBadRequest)
                         return
                 }
 
-                // Set the appropriate Content-Type header
-                w.Header().Set("Content-Type", "application/json")
+                // Check the body is an array of Medicine4 documents; the chaincode
+                // validates each item and reports every rejected one
+                var medicines []Medicine4
+                err = json.Unmarshal(body, &medicines)
+                if err != nil {
+                        http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+                        return
+                }
 
-                // Write the response body
-                w.Write(jsonResponse)
+                contract := getContract(gw, "mychannel", "basic")
+                result, err := CreateMedicinesTransaction(contract, string(body))
+                if err != nil {
+                        log.Println("Error submitting CreateMedicinesTransaction:", err)
+                        if writeBulkError(w, err) {
+                                return
+                        }
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+                log.Printf("success, created %d medicines", len(medicines))
+
+                w.Header().Set("Content-Type", "application/json")
+                w.Write(result)
         })
 
         http.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
@@ -229,7 +1640,11 @@ func main() {
                         return
                 }
 
-                contract := getContract(gw, "mychannel", "basic")
+                contract, err := participants.Contract(r)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusUnauthorized)
+                        return
+                }
 
                 // Read the request body
                 body, err := ioutil.ReadAll(r.Body)
@@ -237,30 +1652,51 @@ func main() {
                         http.Error(w, "Failed to read request body", http.StatusBadRequest)
                         return
                 }
-                // Parse the JSON request body into a Medicine struct
-                var medicine Medicine4
-                err = json.Unmarshal(body, &medicine)
+                // The body holds the medicine ID and only the fields to change
+                var fields map[string]json.RawMessage
+                err = json.Unmarshal(body, &fields)
                 if err != nil {
                         http.Error(w, "Failed to parse request body", http.StatusBadRequest)
                         return
                 }
-                currentTime := time.Now()
-                formattedTime := currentTime.Format("2006-01-02 15:04:02 -0700 MST")
+                var id string
+                err = json.Unmarshal(fields["ID"], &id)
+                if err != nil || id == "" {
+                        http.Error(w, "Missing medicine ID", http.StatusBadRequest)
+                        return
+                }
+                delete(fields, "ID")
 
-                medicine.TimeStamp = formattedTime
+                patch, err := json.Marshal(fields)
+                if err != nil {
+                        http.Error(w, "Failed to build patch", http.StatusInternalServerError)
+                        return
+                }
 
-                result, err := UpdateMedicineTransaction(contract,
-                        medicine.ID, medicine.Name, medicine.Manufacturer, medicine.ManufactureDate, medicine.ExpiryDate,
-                        medicine.BrandName, medicine.Composition, medicine.SenderID, medicine.ReceiverID,
-                        medicine.DRAPNo, medicine.DosageForm, medicine.TimeStamp, medicine.Batch_No, medicine.JourneyCompleted)
+                result, err := PatchMedicineTransaction(contract, id, string(patch))
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         return
                 }
 
-                log.Println(result)
-                log.Println("success")
+                w.Write(result)
+
+        })
+
+        http.HandleFunc("/notifications", func(w http.ResponseWriter, r *http.Request) {
+                if r.Method != http.MethodGet {
+                        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+                        return
+                }
+
+                jsonResponse, err := json.Marshal(notifications.Recent())
+                if err != nil {
+                        http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+                        return
+                }
 
+                w.Header().Set("Content-Type", "application/json")
+                w.Write(jsonResponse)
         })
 
         http.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
@@ -302,15 +1738,197 @@ type Medicine4 struct {
         ReceiverID       string `json:"ReceiverId"`
         DRAPNo           string `json:"DrapNo"`
         DosageForm       string `json:"DosageForm"`
-        TimeStamp        string `json:"TimeStamp"`
         Batch_No         string `json:"Batch_No"`
         JourneyCompleted string `json:"JourneyCompleted"`
+        GTIN             string `json:"GTIN,omitempty"`
 }
 
 type GetMedicine struct {
         ID string `json:"ID"`
 }
 
+// TransferRequest is the body of the /transfer endpoints. ReceiverId is only
+// used when initiating and Reason only when rejecting or cancelling.
+type TransferRequest struct {
+        ID         string `json:"ID"`
+        ReceiverID string `json:"ReceiverId"`
+        Reason     string `json:"Reason"`
+}
+
+// BulkTransferRequest is the body of a /transfer/bulk request.
+type BulkTransferRequest struct {
+        IDs        []string `json:"IDs"`
+        SenderID   string   `json:"SenderId"`
+        ReceiverID string   `json:"ReceiverId"`
+}
+
+// ContainerRequest is the body of the /container endpoints. Type is box, case
+// or pallet and is only used when creating a container; Children lists the
+// medicine and container IDs to pack or unpack, an empty list unpacking all.
+type ContainerRequest struct {
+        ID         string   `json:"ID"`
+        Type       string   `json:"Type"`
+        Children   []string `json:"Children"`
+        ReceiverID string   `json:"ReceiverId"`
+        Reason     string   `json:"Reason"`
+}
+
+// ReturnRequest is the body of a /return request. Reason is one of damaged,
+// near-expiry, recall, overstock or misdelivery. /return/reject and
+// /return/cancel take a TransferRequest instead.
+type ReturnRequest struct {
+        ID             string `json:"ID"`
+        ManufacturerID string `json:"ManufacturerId"`
+        Reason         string `json:"Reason"`
+        Note           string `json:"Note"`
+}
+
+// RecallRequest is the body of a /recall request. Batch numbers are only
+// unique within a manufacturer, so both are required. Severity is ClassI,
+// ClassII or ClassIII.
+type RecallRequest struct {
+        Manufacturer string `json:"Manufacturer"`
+        BatchNo      string `json:"Batch_No"`
+        Reason       string `json:"Reason"`
+        Severity     string `json:"Severity"`
+}
+
+// RegistrationRequest is the body of a POST /registration request. Dates are
+// YYYY-MM-DD.
+type RegistrationRequest struct {
+        DRAPNo             string `json:"DrapNo"`
+        ApprovedName       string `json:"ApprovedName"`
+        Composition        string `json:"Composition"`
+        DosageForm         string `json:"DosageForm"`
+        Strength           string `json:"Strength"`
+        RegistrationHolder string `json:"RegistrationHolder"`
+        ValidFrom          string `json:"ValidFrom"`
+        ValidUntil         string `json:"ValidUntil"`
+}
+
+// ProductRequest is the body of the /product and /product/correct requests.
+// Manufacturer and DrapNo are only used when adding a product.
+type ProductRequest struct {
+        GTIN         string `json:"GTIN"`
+        Name         string `json:"Name"`
+        BrandName    string `json:"BrandName"`
+        Composition  string `json:"Composition"`
+        DosageForm   string `json:"DosageForm"`
+        Manufacturer string `json:"Manufacturer"`
+        DRAPNo       string `json:"DrapNo"`
+}
+
+// ParticipantRequest is the body of a /participant request. Type is one of
+// manufacturer, distributor, pharmacy or hospital; LicenseExpiry is YYYY-MM-DD.
+type ParticipantRequest struct {
+        ID            string `json:"ID"`
+        Name          string `json:"Name"`
+        Type          string `json:"Type"`
+        LicenseNo     string `json:"LicenseNo"`
+        LicenseExpiry string `json:"LicenseExpiry"`
+        MSPID         string `json:"MspId"`
+        Address       string `json:"Address"`
+}
+
+// ParticipantStatusRequest is the body of a /participant/status request.
+// Status is Active, Suspended or Revoked.
+type ParticipantStatusRequest struct {
+        ID     string `json:"ID"`
+        Status string `json:"Status"`
+        Reason string `json:"Reason"`
+}
+
+// CommercialTermsRequest is the body of the /terms endpoints. Counterparty is
+// the MSP ID of the trading partner; Terms is only used when storing terms and
+// is sent to the chaincode through the transient map. MspId is only used when
+// verifying terms between two other organisations.
+type CommercialTermsRequest struct {
+        ID           string          `json:"ID"`
+        MSPID        string          `json:"MspId"`
+        Counterparty string          `json:"Counterparty"`
+        Terms        json.RawMessage `json:"Terms"`
+}
+
+// VerifyRequest is the body of a /verify request. Location is either
+// "latitude,longitude" or a place name.
+type VerifyRequest struct {
+        ID       string `json:"ID"`
+        Location string `json:"Location"`
+}
+
+// DispenseRequest is the body of a /dispense request. PatientRef is the
+// pharmacy's own reference for the patient; only its salted HMAC is sent to
+// the ledger.
+type DispenseRequest struct {
+        ID         string `json:"ID"`
+        PharmacyID string `json:"PharmacyId"`
+        PatientRef string `json:"PatientRef"`
+}
+
+// patientRefSaltEnv names the environment variable holding the pharmacy's
+// secret salt for patient references. Keep it stable: the same patient must
+// map to the same reference to trace recalled stock back to patients.
+const patientRefSaltEnv = "PATIENT_REF_SALT"
+
+// pseudonymisePatientRef returns the hex encoded HMAC-SHA256 of a patient
+// reference keyed with the salt.
+func pseudonymisePatientRef(salt, patientRef string) string {
+        mac := hmac.New(sha256.New, []byte(salt))
+        mac.Write([]byte(patientRef))
+        return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bulkErrorPrefix precedes the JSON BulkError in the message of a rejected
+// bulk transaction; it must match the chaincode's bulkErrorPrefix.
+const bulkErrorPrefix = "rejected items: "
+
+// writeBulkError responds with the rejected items of a bulk transaction when
+// err carries the chaincode's BulkError, and reports whether it did. Only the
+// JSON value following bulkErrorPrefix is decoded, whatever the SDK wraps
+// around the chaincode's message.
+func writeBulkError(w http.ResponseWriter, err error) bool {
+        message := err.Error()
+        start := strings.Index(message, bulkErrorPrefix)
+        if start < 0 {
+                return false
+        }
+
+        var payload json.RawMessage
+        err = json.NewDecoder(strings.NewReader(message[start+len(bulkErrorPrefix):])).Decode(&payload)
+        if err != nil {
+                return false
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusUnprocessableEntity)
+        w.Write(payload)
+        return true
+}
+
+// DecommissionRequest is the body of a /decommission request. Reason is one of
+// destroyed, lost, stolen, sample or damaged.
+type DecommissionRequest struct {
+        ID     string `json:"ID"`
+        Reason string `json:"Reason"`
+        Note   string `json:"Note"`
+}
+
+// ExpireRequest is the body of an /expire request, naming the holder whose
+// expired stock is taken out of the supply chain.
+type ExpireRequest struct {
+        Holder string `json:"Holder"`
+}
+
+// MedicineQuery is the body of a /query request. Selector is a CouchDB Mango
+// selector; SortField and Limit are optional.
+type MedicineQuery struct {
+        Selector  json.RawMessage `json:"Selector"`
+        SortField string          `json:"SortField"`
+        SortOrder string          `json:"SortOrder"`
+        Limit     int32           `json:"Limit"`
+        Bookmark  string          `json:"Bookmark"`
+}
+
 func getContract(gw *gateway.Gateway, channel, contractName string) *gateway.Contract {
         network, err := gw.GetNetwork(channel)
         if err != nil {
@@ -326,19 +1944,54 @@ func InitLedgerTransaction(contract *gateway.Contract) ([]byte, error) {
         return contract.SubmitTransaction("InitLedger")
 }
 
+func InitRegistryTransaction(contract *gateway.Contract) ([]byte, error) {
+        log.Println("--> Submit Transaction: InitRegistry, registers the sample products, requires a regulator identity")
+        return contract.SubmitTransaction("InitRegistry")
+}
+
 func GetAllMedicinesTransaction(contract *gateway.Contract) ([]byte, error) {
         log.Println("--> Evaluate Transaction: GetAllMedicines, function returns all the current assets on the ledger")
         return contract.EvaluateTransaction("GetAllMedicines")
 }
 
+func GetAllMedicinesWithPaginationTransaction(contract *gateway.Contract, pageSize int32, bookmark string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetAllMedicinesWithPagination, function returns one page of the current assets on the ledger")
+        return contract.EvaluateTransaction("GetAllMedicinesWithPagination", strconv.FormatInt(int64(pageSize), 10), bookmark)
+}
+
+func QueryMedicinesTransaction(contract *gateway.Contract, query MedicineQuery) ([]byte, error) {
+        selector := string(query.Selector)
+        limit := strconv.FormatInt(int64(query.Limit), 10)
+
+        switch {
+        case query.SortField != "" && query.Limit > 0:
+                log.Println("--> Evaluate Transaction: QueryMedicinesSortedWithPagination, function returns one sorted page of matching assets")
+                return contract.EvaluateTransaction("QueryMedicinesSortedWithPagination", selector, query.SortField, query.SortOrder, limit, query.Bookmark)
+        case query.SortField != "":
+                log.Println("--> Evaluate Transaction: QueryMedicinesSorted, function returns the matching assets in sorted order")
+                return contract.EvaluateTransaction("QueryMedicinesSorted", selector, query.SortField, query.SortOrder)
+        case query.Limit > 0:
+                log.Println("--> Evaluate Transaction: QueryMedicinesWithPagination, function returns one page of matching assets")
+                return contract.EvaluateTransaction("QueryMedicinesWithPagination", selector, limit, query.Bookmark)
+        default:
+                log.Println("--> Evaluate Transaction: QueryMedicines, function returns the assets matching the selector")
+                return contract.EvaluateTransaction("QueryMedicines", selector)
+        }
+}
+
 func GetMedicineTransaction(contract *gateway.Contract, id string) ([]byte, error) {
         log.Println("--> Evaluate Transaction: GetMedicine, function returns all the current assets on the ledger")
         return contract.EvaluateTransaction("ReadMedicine", id)
 }
 
 func MedicineJourneyTransaction(contract *gateway.Contract, id string) ([]byte, error) {
-        log.Println("--> Evaluate Transaction: GetMedicine, function returns Journey Completed Status")
-        return contract.EvaluateTransaction("MedicineJourney", id)
+        log.Println("--> Submit Transaction: MedicineJourney, deprecated in favour of DispenseMedicine")
+        return contract.SubmitTransaction("MedicineJourney", id)
+}
+
+func ReleaseMedicineTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Submit Transaction: ReleaseMedicine, releases a manufactured medicine for distribution")
+        return contract.SubmitTransaction("ReleaseMedicine", id)
 }
 
 func GetMedicineHistoryTransaction(contract *gateway.Contract, id string) ([]byte, error) {
@@ -346,43 +1999,330 @@ func GetMedicineHistoryTransaction(contract *gateway.Contract, id string) ([]byt
         return contract.EvaluateTransaction("GetMedicineHistory", id)
 }
 
-func CreateMedicineTransaction(contract *gateway.Contract, id, name, manufacturer, manufactureDate, expiryDate,
-        brandName, composition, senderID, receiverID,
-        drapNo, dosageForm, description, batch_No, journeyCompleted string) ([]byte, error) {
-        log.Println("--> Submit Transaction: CreateMedicine, creates a new medicine with the given details")
+func GetMedicineProvenanceTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetMedicineProvenance, returns the custody chain of a medicine")
+        return contract.EvaluateTransaction("GetMedicineProvenance", id)
+}
+
+func InitiateTransferTransaction(contract *gateway.Contract, id, receiverID string) ([]byte, error) {
+        log.Println("--> Submit Transaction: InitiateTransfer, offers custody of a medicine to the receiver")
+        return contract.SubmitTransaction("InitiateTransfer", id, receiverID)
+}
+
+func CreateContainerTransaction(contract *gateway.Contract, id, containerType string) ([]byte, error) {
+        log.Println("--> Submit Transaction: CreateContainer, creates an empty box, case or pallet")
+        return contract.SubmitTransaction("CreateContainer", id, containerType)
+}
+
+func PackContainerTransaction(contract *gateway.Contract, id string, children []string) ([]byte, error) {
+        log.Println("--> Submit Transaction: PackContainer, packs medicines and containers into a container")
+        childrenJSON, err := json.Marshal(children)
+        if err != nil {
+                return nil, err
+        }
+        return contract.SubmitTransaction("PackContainer", id, string(childrenJSON))
+}
+
+func UnpackContainerTransaction(contract *gateway.Contract, id string, children []string) ([]byte, error) {
+        log.Println("--> Submit Transaction: UnpackContainer, takes medicines and containers out of a container")
+        if children == nil {
+                children = []string{}
+        }
+        childrenJSON, err := json.Marshal(children)
+        if err != nil {
+                return nil, err
+        }
+        return contract.SubmitTransaction("UnpackContainer", id, string(childrenJSON))
+}
+
+func TransferContainerTransaction(contract *gateway.Contract, id, receiverID string) ([]byte, error) {
+        log.Println("--> Submit Transaction: TransferContainer, offers custody of a container and its contents")
+        return contract.SubmitTransaction("TransferContainer", id, receiverID)
+}
+
+func AcceptContainerTransferTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Submit Transaction: AcceptContainerTransfer, takes custody of a container and its contents")
+        return contract.SubmitTransaction("AcceptContainerTransfer", id)
+}
+
+func RejectContainerTransferTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: RejectContainerTransfer, declines a pending container transfer")
+        return contract.SubmitTransaction("RejectContainerTransfer", id, reason)
+}
+
+func CancelContainerTransferTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: CancelContainerTransfer, withdraws a pending container transfer")
+        return contract.SubmitTransaction("CancelContainerTransfer", id, reason)
+}
+
+func RecallContainerTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: RecallContainer, recalls everything inside a container")
+        return contract.SubmitTransaction("RecallContainer", id, reason)
+}
+
+func ReadContainerTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadContainer, function returns a container")
+        return contract.EvaluateTransaction("ReadContainer", id)
+}
+
+func GetContainerUnitsTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetContainerUnits, function returns every medicine inside a container")
+        return contract.EvaluateTransaction("GetContainerUnits", id)
+}
+
+func AcceptTransferTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Submit Transaction: AcceptTransfer, takes custody of a medicine with a pending transfer")
+        return contract.SubmitTransaction("AcceptTransfer", id)
+}
+
+func RejectTransferTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: RejectTransfer, declines a pending transfer")
+        return contract.SubmitTransaction("RejectTransfer", id, reason)
+}
+
+func CancelTransferTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: CancelTransfer, withdraws a pending transfer")
+        return contract.SubmitTransaction("CancelTransfer", id, reason)
+}
+
+func GetPendingTransfersTransaction(contract *gateway.Contract, participant string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetPendingTransfers, function returns the pending transfers of a participant")
+        return contract.EvaluateTransaction("GetPendingTransfers", participant)
+}
+
+func ReturnMedicineTransaction(contract *gateway.Contract, id, manufacturerID, reason, note string) ([]byte, error) {
+        log.Println("--> Submit Transaction: ReturnMedicine, sends a medicine back to its manufacturer")
+        return contract.SubmitTransaction("ReturnMedicine", id, manufacturerID, reason, note)
+}
+
+func AcknowledgeReturnTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Submit Transaction: AcknowledgeReturn, confirms receipt of a returned medicine")
+        return contract.SubmitTransaction("AcknowledgeReturn", id)
+}
+
+func RejectReturnTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: RejectReturn, refuses a pending return")
+        return contract.SubmitTransaction("RejectReturn", id, reason)
+}
+
+func CancelReturnTransaction(contract *gateway.Contract, id, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: CancelReturn, withdraws a pending return")
+        return contract.SubmitTransaction("CancelReturn", id, reason)
+}
+
+func ReadReturnTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadReturn, returns the latest return of a medicine")
+        return contract.EvaluateTransaction("ReadReturn", id)
+}
+
+func GetPendingReturnsTransaction(contract *gateway.Contract, participant string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetPendingReturns, function returns the pending returns of a participant")
+        return contract.EvaluateTransaction("GetPendingReturns", participant)
+}
+
+func GetHolderInventoryTransaction(contract *gateway.Contract, holder string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetHolderInventory, returns a holder's stock with returns listed apart")
+        return contract.EvaluateTransaction("GetHolderInventory", holder)
+}
+
+func RecallBatchTransaction(contract *gateway.Contract, manufacturer, batchNo, reason, severity string) ([]byte, error) {
+        log.Println("--> Submit Transaction: RecallBatch, recalls every medicine in a manufacturer's batch")
+        return contract.SubmitTransaction("RecallBatch", manufacturer, batchNo, reason, severity)
+}
+
+func GetActiveRecallsTransaction(contract *gateway.Contract) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetActiveRecalls, function returns the recalls that are still active")
+        return contract.EvaluateTransaction("GetActiveRecalls")
+}
+
+func RegisterDRAPProductTransaction(contract *gateway.Contract, registration RegistrationRequest) ([]byte, error) {
+        log.Println("--> Submit Transaction: RegisterDRAPProduct, adds or renews a product in the DRAP registry")
+        return contract.SubmitTransaction("RegisterDRAPProduct", registration.DRAPNo, registration.ApprovedName,
+                registration.Composition, registration.DosageForm, registration.Strength,
+                registration.RegistrationHolder, registration.ValidFrom, registration.ValidUntil)
+}
+
+func ReadDRAPRegistrationTransaction(contract *gateway.Contract, drapNo string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadDRAPRegistration, function returns a DRAP product registration")
+        return contract.EvaluateTransaction("ReadDRAPRegistration", drapNo)
+}
+
+func GetDRAPRegistrationsTransaction(contract *gateway.Contract) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetDRAPRegistrations, function returns the DRAP product registry")
+        return contract.EvaluateTransaction("GetDRAPRegistrations")
+}
+
+func AddProductTransaction(contract *gateway.Contract, product ProductRequest) ([]byte, error) {
+        log.Println("--> Submit Transaction: AddProduct, adds a SKU to the product catalog")
+        return contract.SubmitTransaction("AddProduct", product.GTIN, product.Name, product.BrandName,
+                product.Composition, product.DosageForm, product.Manufacturer, product.DRAPNo)
+}
+
+func CorrectProductTransaction(contract *gateway.Contract, product ProductRequest) ([]byte, error) {
+        log.Println("--> Submit Transaction: CorrectProduct, corrects the attributes of a catalog product")
+        return contract.SubmitTransaction("CorrectProduct", product.GTIN, product.Name, product.BrandName,
+                product.Composition, product.DosageForm)
+}
+
+func ReadProductTransaction(contract *gateway.Contract, gtin string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadProduct, function returns a catalog product")
+        return contract.EvaluateTransaction("ReadProduct", gtin)
+}
+
+func GetProductsTransaction(contract *gateway.Contract) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetProducts, function returns the product catalog")
+        return contract.EvaluateTransaction("GetProducts")
+}
+
+func RegisterParticipantTransaction(contract *gateway.Contract, participant ParticipantRequest) ([]byte, error) {
+        log.Println("--> Submit Transaction: RegisterParticipant, adds or updates a licensed participant")
+        return contract.SubmitTransaction("RegisterParticipant", participant.ID, participant.Name, participant.Type,
+                participant.LicenseNo, participant.LicenseExpiry, participant.MSPID, participant.Address)
+}
+
+func SetParticipantStatusTransaction(contract *gateway.Contract, id, status, reason string) ([]byte, error) {
+        log.Println("--> Submit Transaction: SetParticipantStatus, suspends, revokes or reinstates a participant")
+        return contract.SubmitTransaction("SetParticipantStatus", id, status, reason)
+}
+
+func ReadParticipantTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadParticipant, function returns a registered participant")
+        return contract.EvaluateTransaction("ReadParticipant", id)
+}
+
+func GetParticipantsTransaction(contract *gateway.Contract) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetParticipants, function returns the participant registry")
+        return contract.EvaluateTransaction("GetParticipants")
+}
+
+func GetMedicinesExpiringBeforeTransaction(contract *gateway.Contract, before, holder string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: GetMedicinesExpiringBefore, function returns the stock expiring before a date")
+        return contract.EvaluateTransaction("GetMedicinesExpiringBefore", before, holder)
+}
+
+func ExpireMedicinesTransaction(contract *gateway.Contract, holder string) ([]byte, error) {
+        log.Println("--> Submit Transaction: ExpireMedicines, moves a holder's expired stock to Expired")
+        return contract.SubmitTransaction("ExpireMedicines", holder)
+}
+
+func PutCommercialTermsTransaction(contract *gateway.Contract, id, counterparty string, terms []byte) ([]byte, error) {
+        log.Println("--> Submit Transaction: PutCommercialTerms, stores commercial terms in the trading partners' private collection")
+        txn, err := contract.CreateTransaction("PutCommercialTerms",
+                gateway.WithTransient(map[string][]byte{"commercial_terms": terms}))
+        if err != nil {
+                return nil, err
+        }
+
+        return txn.Submit(id, counterparty)
+}
+
+func ReadCommercialTermsTransaction(contract *gateway.Contract, id, counterparty string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadCommercialTerms, function returns the private commercial terms of a medicine")
+        return contract.EvaluateTransaction("ReadCommercialTerms", id, counterparty)
+}
 
-        response, err := contract.SubmitTransaction("CreateMedicine", id, name, manufacturer,
-                manufactureDate,
-                expiryDate,
-                brandName, composition, senderID, receiverID,
-                drapNo, dosageForm, description, batch_No, journeyCompleted)
+func VerifyCommercialTermsTransaction(contract *gateway.Contract, id, mspID, counterparty string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: VerifyCommercialTerms, function checks private terms against their public hash")
+        return contract.EvaluateTransaction("VerifyCommercialTerms", id, mspID, counterparty)
+}
+
+func VerifyMedicineTransaction(contract *gateway.Contract, id, location string) ([]byte, error) {
+        log.Println("--> Submit Transaction: VerifyMedicine, records an authenticity scan and returns the verdict")
+        return contract.SubmitTransaction("VerifyMedicine", id, location)
+}
+
+func DispenseMedicineTransaction(contract *gateway.Contract, id, pharmacyID, patientRef string) ([]byte, error) {
+        log.Println("--> Submit Transaction: DispenseMedicine, dispenses a medicine to a patient")
+        return contract.SubmitTransaction("DispenseMedicine", id, pharmacyID, patientRef)
+}
+
+func ReadDispensationTransaction(contract *gateway.Contract, id string) ([]byte, error) {
+        log.Println("--> Evaluate Transaction: ReadDispensation, returns the dispensation of a medicine")
+        return contract.EvaluateTransaction("ReadDispensation", id)
+}
+
+func DecommissionMedicineTransaction(contract *gateway.Contract, id, reason, note string) ([]byte, error) {
+        log.Println("--> Submit Transaction: DecommissionMedicine, takes a medicine out of the supply chain")
+        return contract.SubmitTransaction("DecommissionMedicine", id, reason, note)
+}
+
+func CreateMedicineTransaction(contract *gateway.Contract, medicineJSON string) ([]byte, error) {
+        log.Println("--> Submit Transaction: CreateMedicineJSON, creates a new medicine with the given details")
+        return contract.SubmitTransaction("CreateMedicineJSON", medicineJSON)
+}
+
+func CreateMedicinesTransaction(contract *gateway.Contract, medicinesJSON string) ([]byte, error) {
+        log.Println("--> Submit Transaction: CreateMedicines, creates every medicine in the list or none of them")
+        return contract.SubmitTransaction("CreateMedicines", medicinesJSON)
+}
+
+func TransferMedicinesTransaction(contract *gateway.Contract, ids []string, senderID, receiverID string) ([]byte, error) {
+        log.Println("--> Submit Transaction: TransferMedicines, offers custody of every listed medicine or none of them")
+        idsJSON, err := json.Marshal(ids)
+        if err != nil {
+                return nil, err
+        }
+        return contract.SubmitTransaction("TransferMedicines", string(idsJSON), senderID, receiverID)
+}
 
-        return response, err
+func PatchMedicineTransaction(contract *gateway.Contract, id, patch string) ([]byte, error) {
+        log.Println("--> Submit Transaction: PatchMedicine, updates only the given fields of a medicine")
+        return contract.SubmitTransaction("PatchMedicine", id, patch)
+}
 
+// walletIdentity is a test network user the server signs transactions as.
+type walletIdentity struct {
+        Label string
+        MSPID string
+        Org   string
+        User  string
 }
 
-func UpdateMedicineTransaction(contract *gateway.Contract, id, name, manufacturer, manufactureDate, expiryDate,
-        brandName, composition, senderID, receiverID,
-        drapNo, dosageForm, description, batch_No, journeyCompleted string) ([]byte, error) {
-        log.Println("--> Submit Transaction: UpdateMedicine")
-        return contract.SubmitTransaction("UpdateMedicine", id, name, manufacturer,
-                manufactureDate,
-                expiryDate,
-                brandName, composition, senderID, receiverID,
-                drapNo, dosageForm, description, batch_No, journeyCompleted)
+var (
+        // appIdentity signs as Org1's User1, a manufacturer.
+        appIdentity = walletIdentity{
+                Label: "appUser",
+                MSPID: "Org1MSP",
+                Org:   "org1.example.com",
+                User:  "User1@org1.example.com",
+        }
+        // regulatorIdentity signs as Org2's User1, which the chaincode treats
+        // as the regulator.
+        regulatorIdentity = walletIdentity{
+                Label: "regulatorUser",
+                MSPID: "Org2MSP",
+                Org:   "org2.example.com",
+                User:  "User1@org2.example.com",
+        }
+)
+
+func connectGateway(wallet *gateway.Wallet, identity walletIdentity) (*gateway.Gateway, error) {
+        ccpPath := filepath.Join(
+                "..",
+                "..",
+                "test-network",
+                "organizations",
+                "peerOrganizations",
+                mspProfiles[identity.MSPID],
+        )
+
+        return gateway.Connect(
+                gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
+                gateway.WithIdentity(wallet, identity.Label),
+        )
 }
 
-func populateWallet(wallet *gateway.Wallet) error {
-        log.Println("============ Populating wallet ============")
+func populateWallet(wallet *gateway.Wallet, identity walletIdentity) error {
+        log.Printf("============ Populating wallet with %s ============", identity.Label)
         credPath := filepath.Join(
                 "..",
                 "..",
                 "test-network",
                 "organizations",
                 "peerOrganizations",
-                "org1.example.com",
+                identity.Org,
                 "users",
-                "User1@org1.example.com",
+                identity.User,
                 "msp",
         )
 
@@ -405,7 +2345,7 @@ func populateWallet(wallet *gateway.Wallet) error {
                         return err
                 }
 
-                err = wallet.Put("appUser", gateway.NewX509Identity("Org1MSP", string(cert), string(key)))
+                err = wallet.Put(identity.Label, gateway.NewX509Identity(identity.MSPID, string(cert), string(key)))
                 if err != nil {
                         return err
                 }